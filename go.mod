@@ -1,3 +1,9 @@
 module github.com/iwanhae/ytdl2
 
 go 1.26
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	go.etcd.io/bbolt v1.5.0
+	golang.org/x/sys v0.45.0
+)
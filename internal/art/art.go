@@ -0,0 +1,192 @@
+// Package art extracts and caches cover art for library files. The picture
+// comes from the file itself — the attached picture of an audio file (yt-dlp
+// embeds the video thumbnail at download time) or a representative frame of a
+// video — and is stored as JPEGs in a few fixed sizes under the sidecar dir.
+package art
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Size names one of the stored thumbnail sizes.
+type Size string
+
+const (
+	SizeSmall  Size = "small"
+	SizeMedium Size = "medium"
+	SizeLarge  Size = "large"
+)
+
+// Sizes maps each size to the bounding box (pixels) the picture is fitted into.
+var Sizes = map[Size]int{
+	SizeSmall:  96,
+	SizeMedium: 300,
+	SizeLarge:  600,
+}
+
+// ErrNoArt means the file has no picture to extract (e.g. a bare MP3).
+var ErrNoArt = errors.New("no artwork")
+
+// Store caches artwork as <dir>/<key>-<size>.jpg, keyed by the file's
+// library-relative name. A <key>.none marker remembers files without artwork
+// so they aren't re-probed until they change.
+type Store struct {
+	dir   string
+	locks fsutil.FileLocks // per-name, so one file is only extracted once at a time
+}
+
+// NewStore returns a store rooted at dir (created lazily on first write).
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func key(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// Path is where the given size of name's artwork lives.
+func (s *Store) Path(name string, size Size) string {
+	return filepath.Join(s.dir, key(name)+"-"+string(size)+".jpg")
+}
+
+func (s *Store) marker(name string) string {
+	return filepath.Join(s.dir, key(name)+".none")
+}
+
+// Lookup reports whether up-to-date artwork exists for name, and when it was
+// generated. Artwork older than the source file counts as missing.
+func (s *Store) Lookup(name string, srcModTime time.Time) (time.Time, bool) {
+	info, err := os.Stat(s.Path(name, SizeLarge))
+	if err != nil || info.ModTime().Before(srcModTime) {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// Ensure makes sure artwork for name (at absolute path srcPath) is present and
+// current, extracting it with ffmpeg if needed. It returns ErrNoArt if the file
+// has no picture; that answer is remembered until the file changes.
+func (s *Store) Ensure(name, srcPath string) error {
+	src, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	unlock := s.locks.Lock(name)
+	defer unlock()
+
+	if _, ok := s.Lookup(name, src.ModTime()); ok {
+		return nil
+	}
+	if info, err := os.Stat(s.marker(name)); err == nil && !info.ModTime().Before(src.ModTime()) {
+		return ErrNoArt
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	if err := s.extract(name, srcPath); err != nil {
+		if errors.Is(err, ErrNoArt) {
+			if f, err := os.Create(s.marker(name)); err == nil {
+				f.Close()
+			}
+		}
+		return err
+	}
+	os.Remove(s.marker(name))
+	return nil
+}
+
+// extract runs a single ffmpeg pass that picks a representative frame from the
+// first video stream (an attached picture is a one-frame stream) and writes
+// every size, then moves the results into place.
+func (s *Store) extract(name, srcPath string) error {
+	tmpDir, err := os.MkdirTemp(s.dir, ".art-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sizes := []Size{SizeSmall, SizeMedium, SizeLarge}
+	filter := fmt.Sprintf("[0:v:0]thumbnail,split=%d", len(sizes))
+	for i := range sizes {
+		filter += fmt.Sprintf("[s%d]", i)
+	}
+	for i, size := range sizes {
+		px := Sizes[size]
+		filter += fmt.Sprintf(";[s%d]scale=%d:%d:force_original_aspect_ratio=decrease[o%d]", i, px, px, i)
+	}
+
+	args := []string{"-v", "error", "-i", srcPath, "-filter_complex", filter}
+	for i, size := range sizes {
+		args = append(args, "-map", fmt.Sprintf("[o%d]", i), "-frames:v", "1", "-q:v", "3",
+			filepath.Join(tmpDir, string(size)+".jpg"))
+	}
+
+	out, err := exec.Command("ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		if !hasVideoStream(srcPath) {
+			return ErrNoArt
+		}
+		return fmt.Errorf("ffmpeg %q: %w: %s", srcPath, err, out)
+	}
+
+	for _, size := range sizes {
+		if err := os.Rename(filepath.Join(tmpDir, string(size)+".jpg"), s.Path(name, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasVideoStream asks ffprobe whether path has any video (or picture) stream,
+// to tell "no artwork" apart from a real extraction failure.
+func hasVideoStream(path string) bool {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v",
+		"-show_entries", "stream=index",
+		"-of", "csv=p=0",
+		path,
+	).Output()
+	return err == nil && len(out) > 0
+}
+
+// Delete removes all artwork (and any no-artwork marker) for name.
+func (s *Store) Delete(name string) error {
+	paths := []string{s.marker(name)}
+	for size := range Sizes {
+		paths = append(paths, s.Path(name, size))
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename re-keys all artwork (and any no-artwork marker) from oldName to
+// newName. Missing files are skipped.
+func (s *Store) Rename(oldName, newName string) error {
+	moves := [][2]string{{s.marker(oldName), s.marker(newName)}}
+	for size := range Sizes {
+		moves = append(moves, [2]string{s.Path(oldName, size), s.Path(newName, size)})
+	}
+	for _, m := range moves {
+		if err := os.Rename(m[0], m[1]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
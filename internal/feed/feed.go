@@ -0,0 +1,145 @@
+// Package feed writes podcast feeds — RSS 2.0 with the iTunes namespace that
+// podcast apps expect — and reads RSS and Atom feeds to subscribe to.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Channel is a podcast feed.
+type Channel struct {
+	Title       string
+	Link        string // the show's web page
+	Description string
+	Image       string // cover art URL
+	Author      string
+	Items       []Item
+}
+
+// Item is one episode.
+type Item struct {
+	GUID        string // stable across fetches, so apps don't download twice
+	Title       string
+	Link        string
+	Description string
+	Published   time.Time
+	Duration    float64 // seconds; 0 if unknown
+	Image       string
+	Enclosure   Enclosure
+}
+
+// Enclosure is the episode's media file.
+type Enclosure struct {
+	URL    string
+	Length int64 // bytes
+	Type   string
+}
+
+// The RSS 2.0 document; iTunes elements are written with a literal prefix,
+// which encoding/xml leaves alone.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	Generator   string       `xml:"generator"`
+	Author      string       `xml:"itunes:author,omitempty"`
+	Image       *itunesImage `xml:"itunes:image"`
+	Explicit    string       `xml:"itunes:explicit"`
+	Items       []rssItem    `xml:"item"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Duration    string       `xml:"itunes:duration,omitempty"`
+	Image       *itunesImage `xml:"itunes:image"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// WriteRSS writes ch as an RSS 2.0 feed.
+func WriteRSS(w io.Writer, ch Channel) error {
+	doc := rss{
+		Version: "2.0",
+		ITunes:  itunesNS,
+		Channel: rssChannel{
+			Title:       ch.Title,
+			Link:        ch.Link,
+			Description: ch.Description,
+			Generator:   "ytdl2",
+			Author:      ch.Author,
+			Explicit:    "false",
+			Items:       make([]rssItem, 0, len(ch.Items)),
+		},
+	}
+	if ch.Image != "" {
+		doc.Channel.Image = &itunesImage{Href: ch.Image}
+	}
+	for _, it := range ch.Items {
+		item := rssItem{
+			Title:       it.Title,
+			Link:        it.Link,
+			Description: it.Description,
+			GUID:        rssGUID{Value: it.GUID},
+			Enclosure:   rssEnclosure(it.Enclosure),
+			Duration:    FormatDuration(it.Duration),
+		}
+		if !it.Published.IsZero() {
+			item.PubDate = it.Published.UTC().Format(time.RFC1123Z)
+		}
+		if it.Image != "" {
+			item.Image = &itunesImage{Href: it.Image}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// FormatDuration renders seconds as itunes:duration's H:MM:SS, or "" if
+// unknown.
+func FormatDuration(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	s := int64(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,44 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteRSS(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteRSS(&buf, Channel{
+		Title: "Talks & More",
+		Link:  "http://host/",
+		Items: []Item{{
+			GUID:      "ytdl2:abc",
+			Title:     "Episode <1>",
+			Published: time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC),
+			Duration:  3725.4,
+			Enclosure: Enclosure{URL: "http://host/api/files/ep%201.mp3", Length: 1234, Type: "audio/mpeg"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`,
+		"<title>Talks &amp; More</title>",
+		"<title>Episode &lt;1&gt;</title>",
+		`<guid isPermaLink="false">ytdl2:abc</guid>`,
+		"<pubDate>Tue, 05 Mar 2024 06:07:08 +0000</pubDate>",
+		`<enclosure url="http://host/api/files/ep%201.mp3" length="1234" type="audio/mpeg"></enclosure>`,
+		"<itunes:duration>1:02:05</itunes:duration>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("feed missing %s", want)
+		}
+	}
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Fatalf("feed is not well-formed: %v\n%s", err, out)
+	}
+}
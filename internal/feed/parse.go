@@ -0,0 +1,300 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotFeed is returned by Parse for documents that are neither RSS nor Atom.
+var ErrNotFeed = errors.New("feed: not an RSS or Atom feed")
+
+const (
+	atomNS    = "http://www.w3.org/2005/Atom"
+	contentNS = "http://purl.org/rss/1.0/modules/content/"
+)
+
+// text is an element's text along with its name, so elements of the same
+// local name from different namespaces (title vs itunes:title) can be told
+// apart.
+type text struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// pick returns the text of the first non-empty element in namespace ns.
+func pick(elems []text, ns string) string {
+	for _, e := range elems {
+		if e.XMLName.Space == ns {
+			if v := strings.TrimSpace(e.Value); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+type rssIn struct {
+	Channel struct {
+		Title       []text `xml:"title"`
+		Link        []text `xml:"link"`
+		Description []text `xml:"description"`
+		Summary     []text `xml:"summary"`
+		Author      []text `xml:"author"`
+		// Before Image: a field without a namespace would also take itunes:image.
+		ITunesImage struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Image struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Items []rssItemIn `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItemIn struct {
+	Title       []text `xml:"title"`
+	Link        []text `xml:"link"`
+	Description []text `xml:"description"`
+	Summary     []text `xml:"summary"`
+	Encoded     []text `xml:"encoded"`
+	Duration    []text `xml:"duration"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Enclosure   struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	ITunesImage struct {
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type atomIn struct {
+	Title    string     `xml:"http://www.w3.org/2005/Atom title"`
+	Subtitle string     `xml:"http://www.w3.org/2005/Atom subtitle"`
+	Links    []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Logo     string     `xml:"http://www.w3.org/2005/Atom logo"`
+	Icon     string     `xml:"http://www.w3.org/2005/Atom icon"`
+	Author   string     `xml:"http://www.w3.org/2005/Atom author>name"`
+	Entries  []struct {
+		ID        string     `xml:"http://www.w3.org/2005/Atom id"`
+		Title     string     `xml:"http://www.w3.org/2005/Atom title"`
+		Links     []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Published string     `xml:"http://www.w3.org/2005/Atom published"`
+		Updated   string     `xml:"http://www.w3.org/2005/Atom updated"`
+		Summary   string     `xml:"http://www.w3.org/2005/Atom summary"`
+		Content   string     `xml:"http://www.w3.org/2005/Atom content"`
+		Duration  []text     `xml:"duration"`
+	} `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// Parse reads an RSS 2.0 or Atom feed. Items keep the feed's order; an
+// item's GUID falls back to its enclosure URL, then its link, when the feed
+// doesn't give one.
+func Parse(data []byte) (Channel, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return Channel{}, err
+	}
+	switch {
+	case root.Local == "rss":
+		return parseRSS(data)
+	case root.Local == "feed" && root.Space == atomNS:
+		return parseAtom(data)
+	}
+	return Channel{}, ErrNotFeed
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = CharsetReader
+	dec.Strict = false // feeds in the wild are often sloppy
+	dec.Entity = xml.HTMLEntity
+	return dec
+}
+
+func rootElement(data []byte) (xml.Name, error) {
+	dec := newDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("%w: %v", ErrNotFeed, err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+func parseRSS(data []byte) (Channel, error) {
+	var doc rssIn
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return Channel{}, fmt.Errorf("feed: parse RSS: %w", err)
+	}
+	c := doc.Channel
+	ch := Channel{
+		Title:       pick(c.Title, ""),
+		Link:        pick(c.Link, ""),
+		Description: firstNonEmpty(pick(c.Description, ""), pick(c.Summary, itunesNS)),
+		Author:      pick(c.Author, itunesNS),
+		Image:       firstNonEmpty(c.ITunesImage.Href, c.Image.URL),
+	}
+	for _, in := range c.Items {
+		it := Item{
+			Title:       pick(in.Title, ""),
+			Link:        pick(in.Link, ""),
+			Description: firstNonEmpty(pick(in.Encoded, contentNS), pick(in.Description, ""), pick(in.Summary, itunesNS)),
+			Published:   parseTime(in.PubDate),
+			Duration:    ParseDuration(pick(in.Duration, itunesNS)),
+			Image:       strings.TrimSpace(in.ITunesImage.Href),
+			Enclosure: Enclosure{
+				URL:  strings.TrimSpace(in.Enclosure.URL),
+				Type: strings.TrimSpace(in.Enclosure.Type),
+			},
+		}
+		it.Enclosure.Length, _ = strconv.ParseInt(strings.TrimSpace(in.Enclosure.Length), 10, 64)
+		it.GUID = firstNonEmpty(strings.TrimSpace(in.GUID), it.Enclosure.URL, it.Link)
+		ch.Items = append(ch.Items, it)
+	}
+	return ch, nil
+}
+
+func parseAtom(data []byte) (Channel, error) {
+	var doc atomIn
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return Channel{}, fmt.Errorf("feed: parse Atom: %w", err)
+	}
+	ch := Channel{
+		Title:       strings.TrimSpace(doc.Title),
+		Description: strings.TrimSpace(doc.Subtitle),
+		Author:      strings.TrimSpace(doc.Author),
+		Image:       firstNonEmpty(doc.Logo, doc.Icon),
+	}
+	for _, l := range doc.Links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			ch.Link = l.Href
+			break
+		}
+	}
+	for _, e := range doc.Entries {
+		it := Item{
+			Title:       strings.TrimSpace(e.Title),
+			Description: firstNonEmpty(e.Content, e.Summary),
+			Published:   parseTime(firstNonEmpty(e.Published, e.Updated)),
+			Duration:    ParseDuration(pick(e.Duration, itunesNS)),
+		}
+		for _, l := range e.Links {
+			switch l.Rel {
+			case "enclosure":
+				if it.Enclosure.URL == "" {
+					it.Enclosure.URL, it.Enclosure.Type = strings.TrimSpace(l.Href), l.Type
+					it.Enclosure.Length, _ = strconv.ParseInt(l.Length, 10, 64)
+				}
+			case "", "alternate":
+				if it.Link == "" {
+					it.Link = strings.TrimSpace(l.Href)
+				}
+			}
+		}
+		it.GUID = firstNonEmpty(strings.TrimSpace(e.ID), it.Enclosure.URL, it.Link)
+		ch.Items = append(ch.Items, it)
+	}
+	return ch, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// timeLayouts are the date formats seen in RSS pubDate (RFC 822 and its
+// common corruptions) and Atom (RFC 3339).
+var timeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime reads a feed date, returning the zero time if it can't.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// ParseDuration reads an itunes:duration — seconds, MM:SS or H:MM:SS — and
+// returns seconds, or 0 if it can't.
+func ParseDuration(s string) float64 {
+	var total float64
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return total
+}
+
+// CharsetReader is an xml.Decoder CharsetReader for feeds and OPML files
+// that declare Latin-1 or its Windows superset, which older podcast hosts and
+// apps still do. Like browsers, it reads all of them as Windows-1252. Other
+// charsets are rejected rather than mis-decoded.
+func CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, len(data))
+		for _, b := range data {
+			r := rune(b)
+			if b >= 0x80 && b < 0xa0 && cp1252[b-0x80] != 0 {
+				r = cp1252[b-0x80]
+			}
+			out = utf8.AppendRune(out, r)
+		}
+		return bytes.NewReader(out), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+// cp1252 is what Windows-1252 puts at 0x80-0x9f, where Latin-1 has control
+// characters; 0 marks the five bytes it leaves undefined.
+var cp1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
@@ -0,0 +1,98 @@
+package feed
+
+import (
+	"testing"
+	"time"
+)
+
+const rssFeed = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+  <title>Caf` + "\xe9" + ` Talk</title>
+  <link>https://example.com/</link>
+  <description>A show.</description>
+  <image><url>https://example.com/small.png</url><title>ignored</title></image>
+  <itunes:image href="https://example.com/cover.jpg"/>
+  <item>
+    <title>Episode 2</title>
+    <itunes:title>Two</itunes:title>
+    <description>short</description>
+    <content:encoded><![CDATA[<p>Long &amp; rich notes</p>]]></content:encoded>
+    <guid isPermaLink="false">ep-2</guid>
+    <pubDate>Wed, 6 Mar 2024 10:00:00 GMT</pubDate>
+    <itunes:duration>1:02:05</itunes:duration>
+    <enclosure url="https://cdn.example.com/ep2.mp3" length="1234" type="audio/mpeg"/>
+  </item>
+  <item>
+    <title>Episode 1</title>
+    <pubDate>Tue, 05 Mar 2024 06:07:08 +0100</pubDate>
+    <itunes:duration>95</itunes:duration>
+    <enclosure url="https://cdn.example.com/ep1.m4a" type="audio/mp4"/>
+  </item>
+</channel>
+</rss>`
+
+func TestParseRSS(t *testing.T) {
+	ch, err := Parse([]byte(rssFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Title != "Café Talk" || ch.Image != "https://example.com/cover.jpg" || len(ch.Items) != 2 {
+		t.Fatalf("channel = %+v", ch)
+	}
+	ep := ch.Items[0]
+	want := Item{
+		GUID:        "ep-2",
+		Title:       "Episode 2",
+		Description: "<p>Long &amp; rich notes</p>",
+		Published:   time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC),
+		Duration:    3725,
+		Enclosure:   Enclosure{URL: "https://cdn.example.com/ep2.mp3", Length: 1234, Type: "audio/mpeg"},
+	}
+	if ep != want {
+		t.Fatalf("item = %+v\nwant %+v", ep, want)
+	}
+	ep = ch.Items[1]
+	if ep.GUID != ep.Enclosure.URL || ep.Duration != 95 || !ep.Published.Equal(time.Date(2024, 3, 5, 5, 7, 8, 0, time.UTC)) {
+		t.Fatalf("item without guid = %+v", ep)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	ch, err := Parse([]byte(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom Show</title>
+  <link rel="self" href="https://example.com/feed.atom"/>
+  <link href="https://example.com/"/>
+  <entry>
+    <id>urn:uuid:1</id>
+    <title>First</title>
+    <updated>2024-03-05T06:07:08Z</updated>
+    <summary>Notes</summary>
+    <link rel="alternate" href="https://example.com/1"/>
+    <link rel="enclosure" href="https://cdn.example.com/1.ogg" type="audio/ogg" length="99"/>
+  </entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Item{
+		GUID:        "urn:uuid:1",
+		Title:       "First",
+		Link:        "https://example.com/1",
+		Description: "Notes",
+		Published:   time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC),
+		Enclosure:   Enclosure{URL: "https://cdn.example.com/1.ogg", Length: 99, Type: "audio/ogg"},
+	}
+	if ch.Title != "Atom Show" || ch.Link != "https://example.com/" || len(ch.Items) != 1 || ch.Items[0] != want {
+		t.Fatalf("channel = %+v", ch)
+	}
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{"", "<html><body>hi</body></html>", "not xml"} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Parse(%q) succeeded", doc)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package fsutil holds small filesystem helpers shared by the sidecar stores.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriteFileAtomic writes data to path via a temp file in the same directory
+// and a rename, so a crash can't leave a half-written file behind. The parent
+// directory is created if needed.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() { os.Remove(tmpName) }
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		cleanup()
+		return err
+	}
+	return nil
+}
+
+// FileLocks serializes work on the same file name. A lock exists only while
+// someone holds or waits for it, so the set doesn't grow with every file ever
+// seen. The zero value is ready to use.
+type FileLocks struct {
+	mu    sync.Mutex
+	locks map[string]*fileLock
+}
+
+type fileLock struct {
+	sync.Mutex
+	refs int // holders plus waiters
+}
+
+// Lock blocks until name is free and returns the function that frees it.
+func (fl *FileLocks) Lock(name string) (unlock func()) {
+	fl.mu.Lock()
+	if fl.locks == nil {
+		fl.locks = make(map[string]*fileLock)
+	}
+	l, ok := fl.locks[name]
+	if !ok {
+		l = &fileLock{}
+		fl.locks[name] = l
+	}
+	l.refs++
+	fl.mu.Unlock()
+
+	l.Lock()
+	return fl.unlocker(name, l)
+}
+
+// TryLock is Lock without the wait: if name is already held (or waited
+// for), it returns ok == false and holds nothing.
+func (fl *FileLocks) TryLock(name string) (unlock func(), ok bool) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	if _, busy := fl.locks[name]; busy {
+		return nil, false
+	}
+	if fl.locks == nil {
+		fl.locks = make(map[string]*fileLock)
+	}
+	l := &fileLock{refs: 1}
+	l.Lock()
+	fl.locks[name] = l
+	return fl.unlocker(name, l), true
+}
+
+func (fl *FileLocks) unlocker(name string, l *fileLock) func() {
+	return func() {
+		l.Unlock()
+		fl.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(fl.locks, name)
+		}
+		fl.mu.Unlock()
+	}
+}
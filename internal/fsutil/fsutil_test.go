@@ -0,0 +1,111 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileLocks(t *testing.T) {
+	var fl FileLocks
+	var wg sync.WaitGroup
+	var a, b int
+	counts := map[string]*int{"a.mp3": &a, "b.mp3": &b}
+	for i := range 50 {
+		name := []string{"a.mp3", "b.mp3"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := fl.Lock(name)
+			defer unlock()
+			*counts[name]++ // a data race unless Lock serializes each name
+		}()
+	}
+	wg.Wait()
+	if a != 25 || b != 25 {
+		t.Fatalf("counts = %d, %d", a, b)
+	}
+	if n := len(fl.locks); n != 0 {
+		t.Fatalf("%d locks left after every holder unlocked", n)
+	}
+
+	unlock, ok := fl.TryLock("a.mp3")
+	if !ok {
+		t.Fatal("TryLock of a free name failed")
+	}
+	if _, ok := fl.TryLock("a.mp3"); ok {
+		t.Fatal("TryLock of a held name succeeded")
+	}
+	unlock()
+	if unlock, ok := fl.TryLock("a.mp3"); !ok {
+		t.Fatal("TryLock after unlock failed")
+	} else {
+		unlock()
+	}
+	if n := len(fl.locks); n != 0 {
+		t.Fatalf("%d locks left after TryLock holders unlocked", n)
+	}
+}
+
+func TestJSONFileSetsCorruptFilesAside(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "things.json")
+	os.WriteFile(path, []byte(`{"version": 1, "things": [`), 0o644)
+
+	f := NewJSONFile(path)
+	v := struct{ Version int }{Version: 7}
+	if err := f.Load(&v); err == nil || v.Version != 0 {
+		t.Fatalf("Load = %v, value %+v; want an error and a zero value", err, v)
+	}
+	backups, _ := filepath.Glob(path + ".corrupt-*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); !strings.HasPrefix(string(data), `{"version": 1`) {
+		t.Fatalf("backup holds %q", data)
+	}
+	if err := f.Save(map[string]int{"version": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file that can't be read isn't overwritten.
+	os.Remove(path)
+	os.Mkdir(path, 0o755)
+	f = NewJSONFile(path)
+	if err := f.Load(&v); err == nil {
+		t.Fatal("Load of a directory succeeded")
+	}
+	if err := f.Save(v); err == nil {
+		t.Fatal("Save over an unreadable file succeeded")
+	}
+	// A missing file is just empty.
+	if err := NewJSONFile(filepath.Join(dir, "none.json")).Load(&v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	src, empty, file := filepath.Join(dir, "src"), filepath.Join(dir, "empty"), filepath.Join(dir, "file")
+	os.Mkdir(src, 0o755)
+	os.Mkdir(empty, 0o755)
+	os.WriteFile(file, []byte("x"), 0o644)
+
+	// Neither an empty folder nor a file is replaced.
+	for _, dst := range []string{empty, file} {
+		if err := RenameNoReplace(src, dst); !os.IsExist(err) {
+			t.Fatalf("rename onto %s = %v, want an exists error", dst, err)
+		}
+	}
+	if err := RenameNoReplace(file, filepath.Join(src, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameNoReplace(src, filepath.Join(dir, "new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "moved")); err != nil {
+		t.Fatalf("after renames: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package fsutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// JSONFile is the file behind one of the small sidecar stores. It never
+// throws data away: a file that doesn't parse is moved aside to
+// <path>.corrupt-<timestamp> before the store starts without it, and a file
+// that can't be read or moved aside is never overwritten.
+type JSONFile struct {
+	path    string
+	blocked error // set when saving would destroy a file we couldn't load
+}
+
+// NewJSONFile returns the sidecar file at path; nothing is read yet.
+func NewJSONFile(path string) *JSONFile {
+	return &JSONFile{path: path}
+}
+
+// Path is where the file lives.
+func (f *JSONFile) Path() string { return f.path }
+
+// Load decodes the file into v. A missing file leaves v alone and isn't an
+// error. On any other error v is zeroed and the error says what became of
+// the file; the caller logs it and starts empty.
+func (f *JSONFile) Load(v any) error {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		f.blocked = fmt.Errorf("%s could not be read, refusing to overwrite it: %w", f.path, err)
+		return fmt.Errorf("read %s: %w — changes will not be saved", f.path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		reflect.ValueOf(v).Elem().SetZero() // don't keep half a decode
+		backup := f.path + ".corrupt-" + time.Now().UTC().Format("20060102-150405")
+		if renameErr := os.Rename(f.path, backup); renameErr != nil {
+			f.blocked = fmt.Errorf("%s is unreadable and could not be moved aside, refusing to overwrite it: %w", f.path, err)
+			return fmt.Errorf("parse %s: %v; could not move it aside: %w — changes will not be saved", f.path, err, renameErr)
+		}
+		return fmt.Errorf("parse %s: %w — moved to %s", f.path, err, backup)
+	}
+	return nil
+}
+
+// Save writes v, indented, with WriteFileAtomic. It fails without writing if
+// Load found a file it couldn't set aside.
+func (f *JSONFile) Save(v any) error {
+	if f.blocked != nil {
+		return f.blocked
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(f.path, data)
+}
+
+// NewID returns a short random ID for a record in a sidecar store, such as
+// "r-1f2e3d4c" for NewID("r").
+func NewID(prefix string) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+)
+
+// RenameNoReplace renames src to dst, failing with an error for which
+// os.IsExist is true if dst already exists, even as an empty directory, which
+// a plain rename would silently replace. On Linux the check and the rename are
+// one atomic step (renameat2 with RENAME_NOREPLACE); elsewhere, and on
+// filesystems that don't support that, see renameNoReplaceFallback.
+func RenameNoReplace(src, dst string) error {
+	return renameNoReplace(src, dst)
+}
+
+// renameNoReplaceFallback does what it can without renameat2. A file is
+// hard-linked to its new name, which is atomic "create only if absent", then
+// unlinked from the old one; a directory, or a file where links aren't
+// supported (some network shares), falls back to stat + rename, which can
+// race with something else creating dst.
+func renameNoReplaceFallback(src, dst string) error {
+	if info, err := os.Lstat(src); err == nil && !info.IsDir() {
+		if err := os.Link(src, dst); err == nil {
+			return os.Remove(src)
+		} else if os.IsExist(err) {
+			return err
+		}
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: fs.ErrExist}
+	}
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fsutil
+
+func renameNoReplace(src, dst string) error {
+	return renameNoReplaceFallback(src, dst)
+}
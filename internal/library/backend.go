@@ -0,0 +1,127 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Backend persists a Store. The Store keeps every track in memory, so a
+// backend only has to load everything once and then durably apply change sets.
+type Backend interface {
+	// Load returns every persisted track.
+	Load() (map[string]Track, error)
+	// Commit applies puts and deletes as a single atomic write.
+	Commit(puts map[string]Track, deletes []string) error
+	Close() error
+}
+
+type fileFormat struct {
+	Version int              `json:"version"`
+	Tracks  map[string]Track `json:"tracks"`
+}
+
+// jsonBackend keeps the library in one JSON file that is rewritten (tmp +
+// rename) on every commit. Simple and human-readable, but each commit costs
+// O(library size), so bulk changes should go through one Store.Batch.
+type jsonBackend struct {
+	path   string
+	tracks map[string]Track // what's on disk; replaced once a commit is written
+
+	// readOnly is set when the file on disk must not be replaced: it was
+	// written by a newer build, or it exists but couldn't be read. Commit
+	// returns it instead of writing.
+	readOnly error
+}
+
+func newJSONBackend(path string) *jsonBackend {
+	return &jsonBackend{path: path, tracks: make(map[string]Track)}
+}
+
+// Load reads the file, upgrading older versions in memory (the original is
+// kept as library.json.v<N> and rewritten in the new layout on the next
+// commit). It never fails, so the server always starts, but it never throws
+// data away either: a file that doesn't parse is moved aside to
+// library.json.corrupt-<timestamp> before starting empty, and a file from a
+// newer build is loaded as far as possible and left untouched.
+func (b *jsonBackend) Load() (map[string]Track, error) {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		log.Printf("library: create dir %s: %v", filepath.Dir(b.path), err)
+		return copyTracks(b.tracks), nil // in-memory only; Commit will retry
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("library: read %s: %v — changes will not be saved", b.path, err)
+			b.readOnly = fmt.Errorf("library: %s could not be read, refusing to overwrite it: %w", b.path, err)
+		}
+		return copyTracks(b.tracks), nil
+	}
+
+	tracks, version, err := decodeLibrary(data)
+	switch {
+	case errors.Is(err, ErrNewerVersion):
+		log.Printf("library: %s: %v — loaded read-only, changes will not be saved", b.path, err)
+		b.readOnly = err
+	case err != nil:
+		backup := b.path + ".corrupt-" + time.Now().UTC().Format("20060102-150405")
+		if renameErr := os.Rename(b.path, backup); renameErr != nil {
+			log.Printf("library: parse %s: %v; could not move it aside: %v — changes will not be saved", b.path, err, renameErr)
+			b.readOnly = fmt.Errorf("library: %s is unreadable and could not be backed up: %w", b.path, err)
+		} else {
+			log.Printf("library: parse %s: %v — moved to %s, starting empty", b.path, err, backup)
+		}
+		return copyTracks(b.tracks), nil
+	case version < schemaVersion:
+		backup := fmt.Sprintf("%s.v%d", b.path, version)
+		if err := fsutil.WriteFileAtomic(backup, data); err != nil {
+			log.Printf("library: back up %s before upgrading: %v — changes will not be saved", b.path, err)
+			b.readOnly = fmt.Errorf("library: could not back up %s before upgrading: %w", b.path, err)
+		} else {
+			log.Printf("library: upgraded %s from v%d to v%d (original kept as %s)", b.path, version, schemaVersion, backup)
+		}
+	}
+	if tracks != nil {
+		b.tracks = tracks
+	}
+	return copyTracks(b.tracks), nil
+}
+
+func (b *jsonBackend) Commit(puts map[string]Track, deletes []string) error {
+	if b.readOnly != nil {
+		return b.readOnly
+	}
+	tracks := copyTracks(b.tracks)
+	for _, name := range deletes {
+		delete(tracks, name)
+	}
+	for name, t := range puts {
+		tracks[name] = t
+	}
+	data, err := json.MarshalIndent(fileFormat{Version: schemaVersion, Tracks: tracks}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(b.path, data); err != nil {
+		return err
+	}
+	b.tracks = tracks
+	return nil
+}
+
+func (b *jsonBackend) Close() error { return nil }
+
+func copyTracks(m map[string]Track) map[string]Track {
+	out := make(map[string]Track, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var tracksBucket = []byte("tracks")
+
+// boltBackend keeps one bbolt key per track, so a commit only writes what
+// changed. Not suitable for network filesystems that lack proper file locks.
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// openBoltBackend opens (or creates) the database at path. On first use —
+// an empty database next to an existing legacyJSON file — the JSON library is
+// imported in one transaction and the file renamed to *.migrated, so the
+// import happens exactly once and the original stays around as a backup.
+func openBoltBackend(path, legacyJSON string) (*boltBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("library: open %s: %w", path, err)
+	}
+	b := &boltBackend{db: db}
+
+	empty := true
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(tracksBucket)
+		if err != nil {
+			return err
+		}
+		k, _ := bucket.Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, statErr := os.Stat(legacyJSON); empty && statErr == nil {
+		legacy := newJSONBackend(legacyJSON)
+		tracks, _ := legacy.Load()
+		if legacy.readOnly != nil {
+			db.Close()
+			return nil, fmt.Errorf("library: import %s: %w", legacyJSON, legacy.readOnly)
+		}
+		if err := b.Commit(tracks, nil); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("library: import %s: %w", legacyJSON, err)
+		}
+		if _, err := os.Stat(legacyJSON); os.IsNotExist(err) {
+			// Unparseable: Load already moved it aside as *.corrupt-*.
+		} else if err := os.Rename(legacyJSON, legacyJSON+".migrated"); err != nil {
+			log.Printf("library: imported %s but could not rename it: %v", legacyJSON, err)
+		}
+		log.Printf("library: imported %d tracks from %s into %s", len(tracks), legacyJSON, path)
+	}
+	return b, nil
+}
+
+// exportBoltLibrary is the import in reverse, for switching back to the json
+// backend: the library in the database at path is written to the JSON file
+// at jsonPath and the database renamed to *.migrated. library.json.migrated
+// can't be used for this, as it predates every change made under bolt.
+func exportBoltLibrary(path, jsonPath string) error {
+	b, err := openBoltBackend(path, "")
+	if err != nil {
+		return err
+	}
+	tracks, err := b.Load()
+	b.Close()
+	if err != nil {
+		return fmt.Errorf("library: export %s: %w", path, err)
+	}
+	if err := newJSONBackend(jsonPath).Commit(tracks, nil); err != nil {
+		return fmt.Errorf("library: export %s: %w", path, err)
+	}
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		log.Printf("library: exported %s but could not rename it: %v", path, err)
+	}
+	log.Printf("library: exported %d tracks from %s into %s", len(tracks), path, jsonPath)
+	return nil
+}
+
+func (b *boltBackend) Load() (map[string]Track, error) {
+	tracks := make(map[string]Track)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tracksBucket).ForEach(func(k, v []byte) error {
+			var t Track
+			if err := json.Unmarshal(v, &t); err != nil {
+				log.Printf("library: skip unreadable entry %q: %v", k, err)
+				return nil
+			}
+			tracks[string(k)] = t
+			return nil
+		})
+	})
+	return tracks, err
+}
+
+func (b *boltBackend) Commit(puts map[string]Track, deletes []string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(tracksBucket)
+		for _, name := range deletes {
+			if err := bucket.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		for name, t := range puts {
+			data, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltBackend) Close() error {
+	return b.db.Close()
+}
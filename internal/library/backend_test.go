@@ -0,0 +1,251 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltImportsLegacyJSONOnce(t *testing.T) {
+	dir := t.TempDir()
+	legacy := Load(filepath.Join(dir, "library.json"))
+	legacy.Set("a.mp3", Track{Category: CategoryMusic, Source: SourceManual, Duration: 200})
+	legacy.Set("b.mp3", Track{Category: CategoryPodcast, Source: SourceGuessed, Duration: 4000})
+
+	s, err := Open("bolt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, ok := s.Get("a.mp3"); !ok || tr.Source != SourceManual || tr.Duration != 200 {
+		t.Fatalf("imported a.mp3 = %+v %v", tr, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "library.json.migrated")); err != nil {
+		t.Fatalf("legacy file not renamed: %v", err)
+	}
+
+	// A batch commits atomically and survives a reopen.
+	err = s.Batch(func(tx *Tx) error {
+		tx.Delete("b.mp3")
+		tx.Put("c.mp3", Track{Category: CategoryMusic, Source: SourceGuessed})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open("bolt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	all := s.All()
+	if len(all) != 2 || all["c.mp3"].Category != CategoryMusic {
+		t.Fatalf("after reopen = %+v", all)
+	}
+}
+
+func TestJSONExportsBoltLibraryWhenSwitchedBack(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("bolt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("a.mp3", Track{Category: CategoryPodcast, Source: SourceManual})
+	s.Close()
+
+	s, err = Open("json", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, ok := s.Get("a.mp3"); !ok || tr.Source != SourceManual {
+		t.Fatalf("exported a.mp3 = %+v %v", tr, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "library.db.migrated")); err != nil {
+		t.Fatalf("database not renamed: %v", err)
+	}
+
+	// And forward again: bolt imports the JSON file as on first use.
+	s.Set("b.mp3", Track{Category: CategoryMusic})
+	s, err = Open("bolt", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if all := s.All(); len(all) != 2 {
+		t.Fatalf("re-imported = %+v", all)
+	}
+}
+
+func TestTxSeesOwnWrites(t *testing.T) {
+	s := Load(filepath.Join(t.TempDir(), "library.json"))
+	s.Set("a.mp3", Track{Category: CategoryMusic})
+	err := s.Batch(func(tx *Tx) error {
+		tx.Delete("a.mp3")
+		if _, ok := tx.Get("a.mp3"); ok {
+			t.Error("deleted track still visible in tx")
+		}
+		tx.Put("a.mp3", Track{Category: CategoryPodcast})
+		if tr, _ := tx.Get("a.mp3"); tr.Category != CategoryPodcast {
+			t.Errorf("tx.Get = %+v", tr)
+		}
+		if names := tx.Names(); len(names) != 1 {
+			t.Errorf("tx.Names = %v", names)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, _ := s.Get("a.mp3"); tr.Category != CategoryPodcast {
+		t.Fatalf("committed = %+v", tr)
+	}
+}
+
+func TestFailedCommitChangesNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.json")
+	s := Load(path)
+	s.Set("a.mp3", Track{Category: CategoryMusic})
+
+	// A non-empty directory in the file's place makes every write fail.
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Batch(func(tx *Tx) error {
+		tx.Delete("a.mp3")
+		tx.Put("b.mp3", Track{Category: CategoryPodcast})
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Batch succeeded")
+	}
+	if all := s.All(); len(all) != 1 || all["a.mp3"].Category != CategoryMusic {
+		t.Fatalf("after failed batch = %+v", all)
+	}
+
+	// The backend didn't keep the failed changes either.
+	os.RemoveAll(path)
+	if err := s.Set("c.mp3", Track{Category: CategoryMusic}); err != nil {
+		t.Fatal(err)
+	}
+	if all := Load(path).All(); len(all) != 2 || all["b.mp3"].Category != "" {
+		t.Fatalf("reloaded = %+v", all)
+	}
+}
+
+func TestJSONUpgradesUnversionedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.json")
+	old := `{"tracks": {"a.mp3": {"category": "podcast", "source": "manual"}}}`
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Load(path)
+	if tr, _ := s.Get("a.mp3"); tr.Source != SourceManual {
+		t.Fatalf("a.mp3 = %+v", tr)
+	}
+	if data, err := os.ReadFile(path + ".v0"); err != nil || string(data) != old {
+		t.Fatalf("pre-upgrade backup = %q, %v", data, err)
+	}
+	if err := s.Set("b.mp3", Track{Category: CategoryMusic}); err != nil {
+		t.Fatal(err)
+	}
+	if _, version, err := decodeLibrary(mustRead(t, path)); err != nil || version != schemaVersion {
+		t.Fatalf("rewritten file version = %d, %v", version, err)
+	}
+}
+
+func TestJSONRefusesToOverwriteNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.json")
+	newer := `{"version": 99, "tracks": {"a.mp3": {"category": "music", "source": "manual"}}, "extra": true}`
+	if err := os.WriteFile(path, []byte(newer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Load(path)
+	if tr, _ := s.Get("a.mp3"); tr.Category != CategoryMusic {
+		t.Fatalf("a.mp3 = %+v", tr)
+	}
+	if err := s.Set("b.mp3", Track{Category: CategoryMusic}); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("Set err = %v, want ErrNewerVersion", err)
+	}
+	if err := s.Update("a.mp3", func(tr *Track) { tr.Category = CategoryPodcast }); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("Update err = %v, want ErrNewerVersion", err)
+	}
+	if err := s.Delete("a.mp3"); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("Delete err = %v, want ErrNewerVersion", err)
+	}
+	// Rejected writes don't show up in later reads either.
+	if all := s.All(); len(all) != 1 || all["a.mp3"].Category != CategoryMusic {
+		t.Fatalf("after rejected writes = %+v", all)
+	}
+	if got := string(mustRead(t, path)); got != newer {
+		t.Fatalf("file was overwritten: %s", got)
+	}
+	if _, err := Open("bolt", filepath.Dir(path)); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("bolt import err = %v, want ErrNewerVersion", err)
+	}
+}
+
+func TestJSONBacksUpCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1, "tracks": {`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Load(path)
+	if n := len(s.All()); n != 0 {
+		t.Fatalf("loaded %d tracks from a corrupt file", n)
+	}
+	backups, _ := filepath.Glob(path + ".corrupt-*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+	if err := s.Set("a.mp3", Track{Category: CategoryMusic}); err != nil {
+		t.Fatalf("Set after backup: %v", err)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestTracksKeepTheirGUID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.json")
+	old := `{"version": 1, "tracks": {"a.mp3": {"category": "podcast", "source": "manual"}}}`
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries from before stored GUIDs keep the one feeds derived from the name.
+	s := Load(path)
+	if tr, _ := s.Get("a.mp3"); tr.GUID != legacyGUID("a.mp3") {
+		t.Fatalf("legacy GUID = %q", tr.GUID)
+	}
+	if tr, _ := Load(path).Get("a.mp3"); tr.GUID != legacyGUID("a.mp3") {
+		t.Fatalf("legacy GUID not saved: %q", tr.GUID)
+	}
+
+	// New ones get a random GUID, which follows a rename and isn't reused.
+	s.Set("b.mp3", Track{Category: CategoryMusic})
+	b, _ := s.Get("b.mp3")
+	if b.GUID == "" || b.GUID == legacyGUID("b.mp3") {
+		t.Fatalf("new GUID = %q", b.GUID)
+	}
+	s.Rename("b.mp3", "c.mp3")
+	if tr, _ := s.Get("c.mp3"); tr.GUID != b.GUID {
+		t.Fatalf("renamed GUID = %q, want %q", tr.GUID, b.GUID)
+	}
+	s.Set("b.mp3", Track{Category: CategoryMusic})
+	if tr, _ := s.Get("b.mp3"); tr.GUID == b.GUID {
+		t.Fatal("new track under an old name reused its GUID")
+	}
+}
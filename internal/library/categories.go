@@ -0,0 +1,237 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// CategoryDef describes one category a track can be filed under.
+type CategoryDef struct {
+	Name  Category `json:"name"`
+	Label string   `json:"label"`
+	Color string   `json:"color,omitempty"` // "#rrggbb"
+	// Rule, if set, guesses this category for new tracks whose duration it
+	// matches. Categories without one are only ever chosen by hand; music and
+	// podcast are the fallback split at the category threshold.
+	Rule *DurationRule `json:"rule,omitempty"`
+}
+
+// DurationRule matches durations in [MinSeconds, MaxSeconds). A zero
+// MaxSeconds means no upper bound.
+type DurationRule struct {
+	MinSeconds float64 `json:"min_seconds,omitempty"`
+	MaxSeconds float64 `json:"max_seconds,omitempty"`
+}
+
+// Matches reports whether a track of the given duration falls in the range.
+func (r DurationRule) Matches(durationSeconds float64) bool {
+	return durationSeconds >= r.MinSeconds && (r.MaxSeconds == 0 || durationSeconds < r.MaxSeconds)
+}
+
+// builtinCategories always exist: every track stored before categories were
+// configurable uses one of them, and they are the threshold fallback.
+var builtinCategories = []CategoryDef{
+	{Name: CategoryMusic, Label: "Music", Color: "#8b5cf6"},
+	{Name: CategoryPodcast, Label: "Podcasts", Color: "#f59e0b"},
+}
+
+// Builtin reports whether c is one of the categories that can't be deleted.
+func (c Category) Builtin() bool {
+	return c == CategoryMusic || c == CategoryPodcast
+}
+
+var (
+	ErrCategoryExists   = errors.New("category already exists")
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrBuiltinCategory  = errors.New("built-in categories can't be deleted")
+	ErrInvalidCategory  = errors.New("invalid category")
+)
+
+var (
+	categoryName  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	categoryColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// validate checks a definition and fills in a missing label.
+func (d *CategoryDef) validate() error {
+	if !categoryName.MatchString(string(d.Name)) {
+		return fmt.Errorf("%w: name %q must be up to 32 lowercase letters, digits, - or _", ErrInvalidCategory, d.Name)
+	}
+	if d.Label == "" {
+		d.Label = string(d.Name)
+	}
+	if d.Color != "" && !categoryColor.MatchString(d.Color) {
+		return fmt.Errorf("%w: color %q must be #rrggbb", ErrInvalidCategory, d.Color)
+	}
+	if r := d.Rule; r != nil {
+		if r.MinSeconds < 0 || r.MaxSeconds < 0 || (r.MaxSeconds != 0 && r.MaxSeconds <= r.MinSeconds) {
+			return fmt.Errorf("%w: rule needs 0 <= min_seconds < max_seconds (or no max_seconds)", ErrInvalidCategory)
+		}
+		if d.Name.Builtin() {
+			return fmt.Errorf("%w: music and podcast are guessed by the category threshold and can't have a rule", ErrInvalidCategory)
+		}
+	}
+	return nil
+}
+
+// CategoryStore is the user-managed set of categories, kept in
+// .ytdl2/categories.json. A nil store has just the built-ins.
+type CategoryStore struct {
+	mu   sync.Mutex
+	file *fsutil.JSONFile
+	defs []CategoryDef // built-ins first, then user categories in creation order
+}
+
+type categoriesFile struct {
+	Version    int           `json:"version"`
+	Categories []CategoryDef `json:"categories"`
+}
+
+// LoadCategories reads the category file at path (a missing file means just
+// the built-ins; an unparseable one is set aside, see fsutil.JSONFile).
+func LoadCategories(path string) *CategoryStore {
+	cs := &CategoryStore{file: fsutil.NewJSONFile(path)}
+	var f categoriesFile
+	if err := cs.file.Load(&f); err != nil {
+		log.Printf("library: %v — using built-in categories", err)
+	}
+
+	// Built-ins keep any label/color edits saved for them.
+	saved := make(map[Category]CategoryDef)
+	for _, d := range f.Categories {
+		saved[d.Name] = d
+	}
+	for _, b := range builtinCategories {
+		if d, ok := saved[b.Name]; ok {
+			d.Rule = nil
+			b = d
+		}
+		cs.defs = append(cs.defs, b)
+	}
+	for _, d := range f.Categories {
+		if d.Name.Builtin() {
+			continue
+		}
+		if err := d.validate(); err != nil {
+			log.Printf("library: %s: skipping category: %v", path, err)
+			continue
+		}
+		cs.defs = append(cs.defs, d)
+	}
+	return cs
+}
+
+// List returns every category, built-ins first.
+func (cs *CategoryStore) List() []CategoryDef {
+	return append([]CategoryDef(nil), cs.current()...)
+}
+
+// current returns the definitions in use. The slice is replaced, never
+// changed, so it may be read without the lock.
+func (cs *CategoryStore) current() []CategoryDef {
+	if cs == nil {
+		return builtinCategories
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.defs
+}
+
+// Valid reports whether c is one of the defined categories.
+func (cs *CategoryStore) Valid(c Category) bool {
+	for _, d := range cs.current() {
+		if d.Name == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify guesses a category from duration. The first user-defined category
+// whose rule matches wins; otherwise tracks at or above the threshold (seconds)
+// are podcasts and shorter ones are music. The threshold is configurable so
+// callers can tune it to their library; anything guessed is overridable.
+func (cs *CategoryStore) Classify(durationSeconds, thresholdSeconds float64) Category {
+	for _, d := range cs.current() {
+		if d.Rule != nil && d.Rule.Matches(durationSeconds) {
+			return d.Name
+		}
+	}
+	if durationSeconds >= thresholdSeconds {
+		return CategoryPodcast
+	}
+	return CategoryMusic
+}
+
+// Create adds a category.
+func (cs *CategoryStore) Create(d CategoryDef) (CategoryDef, error) {
+	if err := d.validate(); err != nil {
+		return d, err
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.index(d.Name) >= 0 {
+		return d, ErrCategoryExists
+	}
+	return d, cs.commit(append(append([]CategoryDef(nil), cs.defs...), d))
+}
+
+// Update applies fn to the named category. The name can't be changed.
+func (cs *CategoryStore) Update(name Category, fn func(d *CategoryDef)) (CategoryDef, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	i := cs.index(name)
+	if i < 0 {
+		return CategoryDef{}, ErrCategoryNotFound
+	}
+	d := cs.defs[i]
+	fn(&d)
+	d.Name = name
+	if err := d.validate(); err != nil {
+		return d, err
+	}
+	defs := append([]CategoryDef(nil), cs.defs...)
+	defs[i] = d
+	return d, cs.commit(defs)
+}
+
+// Delete removes a user category and returns what it was. Tracks and rules
+// still filed under it should be moved elsewhere first; this doesn't touch
+// the library.
+func (cs *CategoryStore) Delete(name Category) (CategoryDef, error) {
+	if name.Builtin() {
+		return CategoryDef{}, ErrBuiltinCategory
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	i := cs.index(name)
+	if i < 0 {
+		return CategoryDef{}, ErrCategoryNotFound
+	}
+	def := cs.defs[i]
+	defs := append(append([]CategoryDef(nil), cs.defs[:i]...), cs.defs[i+1:]...)
+	return def, cs.commit(defs)
+}
+
+func (cs *CategoryStore) index(name Category) int {
+	for i, d := range cs.defs {
+		if d.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// commit saves defs and, once saved, makes them current.
+func (cs *CategoryStore) commit(defs []CategoryDef) error {
+	if err := cs.file.Save(categoriesFile{Version: 1, Categories: defs}); err != nil {
+		return err
+	}
+	cs.defs = defs
+	return nil
+}
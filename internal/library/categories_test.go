@@ -0,0 +1,41 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCategoryStoresAreIndependent(t *testing.T) {
+	books := LoadCategories(filepath.Join(t.TempDir(), "categories.json"))
+	if _, err := books.Create(CategoryDef{Name: "audiobook", Rule: &DurationRule{MinSeconds: 7200}}); err != nil {
+		t.Fatal(err)
+	}
+	plain := LoadCategories(filepath.Join(t.TempDir(), "categories.json"))
+
+	if got := books.Classify(3*3600, 360); got != "audiobook" {
+		t.Fatalf("books.Classify(3h) = %q", got)
+	}
+	if got := plain.Classify(3*3600, 360); got != CategoryPodcast {
+		t.Fatalf("plain.Classify(3h) = %q", got)
+	}
+	if !books.Valid("audiobook") || plain.Valid("audiobook") {
+		t.Fatal("a category defined in one store is valid in another")
+	}
+	var none *CategoryStore
+	if !none.Valid(CategoryMusic) || none.Valid("audiobook") || none.Classify(100, 360) != CategoryMusic {
+		t.Fatal("nil store should have just the built-ins")
+	}
+}
+
+func TestCorruptCategoriesAreSetAside(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "categories.json")
+	os.WriteFile(path, []byte(`{"categories": [{"name": "audiobook"`), 0o644)
+	cs := LoadCategories(path)
+	if got := cs.List(); len(got) != 2 {
+		t.Fatalf("categories = %+v, want just the built-ins", got)
+	}
+	if backups, _ := filepath.Glob(path + ".corrupt-*"); len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+}
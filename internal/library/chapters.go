@@ -0,0 +1,91 @@
+package library
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chapter is a navigation point inside a track. A chapter runs from Start until
+// the next chapter's Start (or the end of the track).
+type Chapter struct {
+	Start float64 `json:"start"` // seconds
+	Title string  `json:"title"`
+}
+
+// SilenceOptions tunes silence-based chapter detection.
+type SilenceOptions struct {
+	NoiseDB    float64 `json:"noise_db"`    // anything quieter than this counts as silence (e.g. -35)
+	MinSilence float64 `json:"min_silence"` // seconds of silence needed to mark a boundary
+	MinChapter float64 `json:"min_chapter"` // boundaries closer than this to the previous one are dropped
+}
+
+// DefaultSilenceOptions suits spoken-word podcasts: a two-second pause well
+// below speech level, and no chapter shorter than a minute.
+var DefaultSilenceOptions = SilenceOptions{NoiseDB: -35, MinSilence: 2, MinChapter: 60}
+
+// SilenceDetectArgs returns the ffmpeg arguments that run the silencedetect
+// filter over path and discard the decoded output. Detections are reported on
+// stderr, one line per event; feed those lines to ChaptersFromSilence.
+func SilenceDetectArgs(path string, opts SilenceOptions) []string {
+	filter := fmt.Sprintf("silencedetect=noise=%sdB:d=%s",
+		strconv.FormatFloat(opts.NoiseDB, 'f', -1, 64),
+		strconv.FormatFloat(opts.MinSilence, 'f', -1, 64))
+	return []string{"-hide_banner", "-nostats", "-i", path, "-vn", "-af", filter, "-f", "null", "-"}
+}
+
+// ChaptersFromSilence derives chapters from silencedetect log lines. Each
+// "silence_end" marks where sound resumes and becomes a candidate boundary;
+// candidates closer than opts.MinChapter to the previous boundary are skipped.
+// The first chapter always starts at 0.
+func ChaptersFromSilence(lines []string, opts SilenceOptions) []Chapter {
+	chapters := []Chapter{{Start: 0}}
+	for _, line := range lines {
+		i := strings.Index(line, "silence_end:")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(line[i+len("silence_end:"):])
+		if len(fields) == 0 {
+			continue
+		}
+		end, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || end <= 0 {
+			continue
+		}
+		if end-chapters[len(chapters)-1].Start < opts.MinChapter {
+			continue
+		}
+		chapters = append(chapters, Chapter{Start: end})
+	}
+	for i := range chapters {
+		chapters[i].Title = fmt.Sprintf("Chapter %d", i+1)
+	}
+	return chapters
+}
+
+// NormalizeChapters validates user-supplied chapters and returns them sorted by
+// start time. Starts must be non-negative, unique and (when the duration is
+// known) inside the track; blank titles are filled in.
+func NormalizeChapters(chapters []Chapter, durationSeconds float64) ([]Chapter, error) {
+	out := make([]Chapter, len(chapters))
+	copy(out, chapters)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	for i, c := range out {
+		if c.Start < 0 {
+			return nil, fmt.Errorf("chapter %d: start must not be negative", i+1)
+		}
+		if durationSeconds > 0 && c.Start >= durationSeconds {
+			return nil, fmt.Errorf("chapter %d: start %.2f is past the end of the track", i+1, c.Start)
+		}
+		if i > 0 && c.Start == out[i-1].Start {
+			return nil, fmt.Errorf("chapter %d: duplicate start %.2f", i+1, c.Start)
+		}
+		out[i].Title = strings.TrimSpace(c.Title)
+		if out[i].Title == "" {
+			out[i].Title = fmt.Sprintf("Chapter %d", i+1)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,124 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// HashFile returns the hex SHA-256 of the whole file.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DuplicateGroup is a set of files with identical content.
+type DuplicateGroup struct {
+	SHA256 string   `json:"sha256"`
+	Size   int64    `json:"size"`
+	Files  []string `json:"files"` // sorted
+}
+
+// FindDuplicates groups the files under dir by content. Candidates are
+// narrowed by size, then by fingerprint, and only the survivors are fully
+// hashed; hashes already stored on a track are reused while its fingerprint
+// still matches. Newly computed hashes are persisted in a single batch for
+// files the library already tracks; untracked files are hashed but not added,
+// so they are still dated and classified when first scanned. Groups are
+// ordered largest files first.
+func (s *Store) FindDuplicates(dir string) ([]DuplicateGroup, error) {
+	sizes, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bySize := make(map[int64][]string)
+	for name, size := range sizes {
+		if size > 0 {
+			bySize[size] = append(bySize[size], name)
+		}
+	}
+
+	type hashes struct{ fingerprint, sha string }
+	computed := make(map[string]hashes)
+	var groups []DuplicateGroup
+	for size, names := range bySize {
+		if len(names) < 2 {
+			continue
+		}
+
+		byFingerprint := make(map[string][]string)
+		for _, name := range names {
+			t, _ := s.Get(name)
+			fp := t.Fingerprint
+			if fp == "" || t.Size != size {
+				if fp, err = Fingerprint(filepath.Join(dir, name)); err != nil {
+					continue
+				}
+				computed[name] = hashes{fingerprint: fp}
+			}
+			byFingerprint[fp] = append(byFingerprint[fp], name)
+		}
+
+		for fp, names := range byFingerprint {
+			if len(names) < 2 {
+				continue
+			}
+			bySHA := make(map[string][]string)
+			for _, name := range names {
+				t, _ := s.Get(name)
+				sha := t.SHA256
+				if sha == "" || t.Fingerprint != fp {
+					if sha, err = HashFile(filepath.Join(dir, name)); err != nil {
+						continue
+					}
+					computed[name] = hashes{fingerprint: fp, sha: sha}
+				}
+				bySHA[sha] = append(bySHA[sha], name)
+			}
+			for sha, names := range bySHA {
+				if len(names) < 2 {
+					continue
+				}
+				sort.Strings(names)
+				groups = append(groups, DuplicateGroup{SHA256: sha, Size: size, Files: names})
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Files[0] < groups[j].Files[0]
+	})
+
+	err = s.Batch(func(tx *Tx) error {
+		for name, h := range computed {
+			t, ok := tx.Get(name)
+			if !ok {
+				continue
+			}
+			if t.Fingerprint != h.fingerprint {
+				t.SHA256 = ""
+			}
+			t.Size, t.Fingerprint = sizes[name], h.fingerprint
+			if h.sha != "" {
+				t.SHA256 = h.sha
+			}
+			tx.Put(name, t)
+		}
+		return nil
+	})
+	return groups, err
+}
@@ -1,23 +1,23 @@
-// Package library persists per-track metadata (category + duration) in a sidecar
-// JSON file on the download volume, so the music/podcast split survives restarts
-// and is shared across browsers. It also owns duration probing (ffprobe) and the
-// auto-classification heuristic.
+// Package library persists per-track metadata (category, duration, embedded
+// tags) in a sidecar JSON file on the download volume, so the music/podcast
+// split survives restarts and is shared across browsers. It also owns media
+// probing (ffprobe) and the auto-classification heuristic.
 package library
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"sync"
+	"time"
 )
 
-// Category is the coarse kind of a track.
+// Category is the coarse kind of a track. Music and podcast are built in;
+// more can be defined at runtime (see CategoryStore).
 type Category string
 
 const (
@@ -25,11 +25,6 @@ const (
 	CategoryPodcast Category = "podcast"
 )
 
-// Valid reports whether c is one of the known categories.
-func (c Category) Valid() bool {
-	return c == CategoryMusic || c == CategoryPodcast
-}
-
 // Source records how a track got its category.
 type Source string
 
@@ -40,55 +35,131 @@ const (
 
 // Track is the per-file metadata we persist.
 type Track struct {
-	Category Category `json:"category"`
-	Source   Source   `json:"source"`
-	Duration float64  `json:"duration,omitempty"` // seconds
+	Category Category  `json:"category"`
+	Source   Source    `json:"source"`
+	Duration float64   `json:"duration,omitempty"` // seconds
+	Chapters []Chapter `json:"chapters,omitempty"`
+	Meta     Metadata  `json:"meta,omitzero"`      // embedded tags
+	Format   Format    `json:"format,omitzero"`    // zero until probed
+	NoAudio  bool      `json:"no_audio,omitempty"` // probed, but no audio stream (so Format stays empty)
+	Tags     []string  `json:"tags,omitempty"`     // free-form labels, see Rule.Match.Tag
+	Speech   Speech    `json:"speech,omitzero"`    // content analysis, if enabled
+	Added    time.Time `json:"added,omitzero"`     // first probed, i.e. about when it was downloaded
+	Episode  *Episode  `json:"episode,omitempty"`  // set for podcast subscription downloads
+	GUID     string    `json:"guid,omitempty"`     // feed GUID, random, given when first stored
+
+	// Size and Fingerprint identify the content, so Reconcile can re-attach
+	// this entry if the file is renamed outside the API. SHA256 is the full
+	// content hash, computed lazily by the duplicate finder and cleared
+	// whenever the fingerprint changes.
+	Size        int64  `json:"size,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
 }
 
-// Store is a concurrency-safe map of filename -> Track backed by a JSON file.
-// The in-memory map is the source of truth for the process; every mutation is
-// flushed atomically (write tmp + rename) so a crash can't leave a half file.
-type Store struct {
-	mu     sync.RWMutex
-	path   string
-	tracks map[string]Track
+// newGUID returns a feed GUID for a track stored for the first time. It is
+// random rather than derived from the name, so a new file that takes an old
+// one's name is still a new episode to podcast apps, and it moves with the
+// track on rename.
+func newGUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "ytdl2:" + hex.EncodeToString(b)
 }
 
-type fileFormat struct {
-	Version int              `json:"version"`
-	Tracks  map[string]Track `json:"tracks"`
+// legacyGUID is the GUID feeds derived from a file's name before tracks stored
+// their own. Entries from then are given it once, on load, so podcast apps
+// don't download them again.
+func legacyGUID(name string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(name)))
+	return "ytdl2:" + hex.EncodeToString(sum[:])
 }
 
-// Load reads the sidecar at path, returning an empty in-memory store if the
-// file is missing or unreadable (never returns an error — callers can always
-// use the returned store).
-func Load(path string) *Store {
-	s := &Store{path: path, tracks: make(map[string]Track)}
+// Episode describes a file downloaded from a podcast feed, as the feed did.
+type Episode struct {
+	Show      string    `json:"show"`
+	Title     string    `json:"title"`
+	Published time.Time `json:"published,omitzero"`
+	Notes     string    `json:"notes,omitempty"` // show notes, often HTML
+	Link      string    `json:"link,omitempty"`
+	GUID      string    `json:"guid,omitempty"`
+}
 
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		log.Printf("library: create dir %s: %v", filepath.Dir(path), err)
-		return s // in-memory only; save() will retry
-	}
+// Store is a concurrency-safe map of filename -> Track backed by a Backend.
+// The in-memory map is the source of truth for the process; every mutation is
+// handed to the backend as one atomic change set (see Batch), so a crash can't
+// leave a half-written library.
+type Store struct {
+	mu      sync.RWMutex
+	backend Backend
+	tracks  map[string]Track
+}
 
-	data, err := os.ReadFile(path)
+// New returns a store over b, loading everything b has persisted.
+func New(b Backend) (*Store, error) {
+	tracks, err := b.Load()
 	if err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("library: read %s: %v", path, err)
-		}
-		return s
+		return nil, err
 	}
-
-	var f fileFormat
-	if err := json.Unmarshal(data, &f); err != nil {
-		log.Printf("library: parse %s: %v — starting empty", path, err)
-		return s
+	if tracks == nil {
+		tracks = make(map[string]Track)
+	}
+	stamped := make(map[string]Track)
+	for name, t := range tracks {
+		if t.GUID == "" {
+			t.GUID = legacyGUID(name)
+			tracks[name], stamped[name] = t, t
+		}
 	}
-	if f.Tracks != nil {
-		s.tracks = f.Tracks
+	if len(stamped) > 0 {
+		if err := b.Commit(stamped, nil); err != nil {
+			log.Printf("library: save feed GUIDs for %d tracks: %v", len(stamped), err)
+		}
 	}
+	return &Store{backend: b, tracks: tracks}, nil
+}
+
+// Load reads the JSON sidecar at path, returning an empty in-memory store if
+// the file is missing or unreadable (never returns an error — callers can
+// always use the returned store).
+func Load(path string) *Store {
+	s, _ := New(newJSONBackend(path)) // the JSON backend's Load never fails
 	return s
 }
 
+// Open returns the store kept in the sidecar dir metaDir using the named
+// backend: "json" (library.json, the default) or "bolt" (library.db, which
+// imports an existing library.json on first use). Switching back to json
+// exports library.db the same way when there is no library.json.
+func Open(backend, metaDir string) (*Store, error) {
+	switch backend {
+	case "", "json":
+		jsonPath, dbPath := filepath.Join(metaDir, "library.json"), filepath.Join(metaDir, "library.db")
+		if _, err := os.Stat(jsonPath); os.IsNotExist(err) {
+			if _, err := os.Stat(dbPath); err == nil {
+				// Back from bolt: bring its library along rather than start empty.
+				if err := exportBoltLibrary(dbPath, jsonPath); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return Load(jsonPath), nil
+	case "bolt":
+		b, err := openBoltBackend(filepath.Join(metaDir, "library.db"), filepath.Join(metaDir, "library.json"))
+		if err != nil {
+			return nil, err
+		}
+		return New(b)
+	default:
+		return nil, fmt.Errorf("library: unknown backend %q", backend)
+	}
+}
+
+// Close releases the backend.
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
 // Get returns the track for name and whether it existed.
 func (s *Store) Get(name string) (Track, bool) {
 	s.mu.RLock()
@@ -97,121 +168,137 @@ func (s *Store) Get(name string) (Track, bool) {
 	return t, ok
 }
 
+// All returns a copy of every track, keyed by name.
+func (s *Store) All() map[string]Track {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyTracks(s.tracks)
+}
+
 // Set stores t for name and persists.
 func (s *Store) Set(name string, t Track) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.tracks[name] = t
-	return s.saveLocked()
+	return s.Batch(func(tx *Tx) error {
+		tx.Put(name, t)
+		return nil
+	})
+}
+
+// Update applies fn to the track for name (the zero Track if there is none yet)
+// and persists the result, so callers can change one field without clobbering
+// the others.
+func (s *Store) Update(name string, fn func(t *Track)) error {
+	return s.Batch(func(tx *Tx) error {
+		t, _ := tx.Get(name)
+		fn(&t)
+		tx.Put(name, t)
+		return nil
+	})
+}
+
+// Rename moves the track stored under oldName to newName (replacing anything
+// already there) and persists. A missing oldName is a no-op.
+func (s *Store) Rename(oldName, newName string) error {
+	return s.Batch(func(tx *Tx) error {
+		if t, ok := tx.Get(oldName); ok {
+			tx.Delete(oldName)
+			tx.Put(newName, t)
+		}
+		return nil
+	})
 }
 
 // Delete removes name and persists. Removing a missing key is a no-op.
 func (s *Store) Delete(name string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.tracks[name]; !ok {
+	return s.Batch(func(tx *Tx) error {
+		tx.Delete(name)
 		return nil
-	}
-	delete(s.tracks, name)
-	return s.saveLocked()
+	})
 }
 
-// saveLocked persists the current map. Caller must hold s.mu.
-func (s *Store) saveLocked() error {
-	data, err := json.MarshalIndent(fileFormat{Version: 1, Tracks: s.tracks}, "", "  ")
-	if err != nil {
-		return err
-	}
-	dir := filepath.Dir(s.path)
-	tmp, err := os.CreateTemp(dir, ".library-*.json.tmp")
-	if err != nil {
-		return err
-	}
-	tmpName := tmp.Name()
-	cleanup := func() { os.Remove(tmpName) }
+// Tx is a set of changes made inside Store.Batch. Reads see the changes made
+// so far in the same Tx.
+type Tx struct {
+	tracks  map[string]Track // the store's live map; read-only here
+	puts    map[string]Track
+	deletes map[string]bool
+}
 
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
-		cleanup()
-		return err
-	}
-	if err := tmp.Close(); err != nil {
-		cleanup()
-		return err
+// Get returns the track for name as of this transaction.
+func (tx *Tx) Get(name string) (Track, bool) {
+	if tx.deletes[name] {
+		return Track{}, false
 	}
-	if err := os.Rename(tmpName, s.path); err != nil {
-		cleanup()
-		return err
+	if t, ok := tx.puts[name]; ok {
+		return t, true
 	}
-	return nil
+	t, ok := tx.tracks[name]
+	return t, ok
 }
 
-// Classify guesses a category from duration. Tracks at or above the threshold
-// (seconds) are podcasts; shorter ones are music. The threshold is configurable
-// so callers can tune it to their library; anything guessed is overridable.
-func Classify(durationSeconds, thresholdSeconds float64) Category {
-	if durationSeconds >= thresholdSeconds {
-		return CategoryPodcast
+// Put stores t for name, giving it a feed GUID if it has none yet.
+func (tx *Tx) Put(name string, t Track) {
+	if t.GUID == "" {
+		t.GUID = newGUID()
 	}
-	return CategoryMusic
+	delete(tx.deletes, name)
+	tx.puts[name] = t
 }
 
-// ProbeDuration returns the media duration in seconds via ffprobe.
-// A non-media file or a missing ffprobe yields an error; callers should skip.
-func ProbeDuration(path string) (float64, error) {
-	out, err := exec.Command("ffprobe",
-		"-v", "error",
-		"-show_entries", "format=duration",
-		"-of", "default=noprint_wrappers=1:nokey=1",
-		path,
-	).Output()
-	if err != nil {
-		return 0, fmt.Errorf("ffprobe %q: %w", path, err)
+// Delete removes name. Removing a missing key is a no-op.
+func (tx *Tx) Delete(name string) {
+	if _, ok := tx.Get(name); !ok {
+		return
 	}
-	d, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
-	if err != nil {
-		return 0, fmt.Errorf("parse duration %q: %w", strings.TrimSpace(string(out)), err)
+	delete(tx.puts, name)
+	if _, ok := tx.tracks[name]; ok {
+		tx.deletes[name] = true
 	}
-	return d, nil
 }
 
-// ScanAndProbe walks dir and, for every file that has no store entry yet, probes
-// its duration and stores a guessed category. Dotfiles (and the .ytdl2 sidecar
-// dir) are skipped. Failures and zero-length durations are skipped so the track
-// simply stays untagged until a manual override. Idempotent, so it doubles as a
-// one-time migration of pre-existing files and as the per-download classifier.
-func (s *Store) ScanAndProbe(dir string, thresholdSeconds float64) {
-	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d == nil {
-			return nil // tolerate unreadable entries
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if strings.HasPrefix(d.Name(), ".") {
-			return nil
+// Names returns every track name as of this transaction, in no order.
+func (tx *Tx) Names() []string {
+	names := make([]string, 0, len(tx.tracks)+len(tx.puts))
+	for name := range tx.tracks {
+		if !tx.deletes[name] {
+			if _, put := tx.puts[name]; !put {
+				names = append(names, name)
+			}
 		}
+	}
+	for name := range tx.puts {
+		names = append(names, name)
+	}
+	return names
+}
 
-		rel, err := filepath.Rel(dir, path)
-		if err != nil {
-			return nil
-		}
-		if _, ok := s.Get(rel); ok {
-			return nil // already classified (manual or guessed)
-		}
+// Batch runs fn under the store's write lock and commits everything it did
+// as one backend write; if fn returns an error nothing is applied. fn must not
+// do slow work (probing, hashing) — compute first, then batch the results.
+func (s *Store) Batch(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		dur, err := ProbeDuration(path)
-		if err != nil {
-			return nil // not media, or ffprobe missing — leave untagged
-		}
-		if dur <= 0 {
-			return nil
-		}
-		_ = s.Set(rel, Track{
-			Category: Classify(dur, thresholdSeconds),
-			Source:   SourceGuessed,
-			Duration: dur,
-		})
+	tx := &Tx{tracks: s.tracks, puts: make(map[string]Track), deletes: make(map[string]bool)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.puts) == 0 && len(tx.deletes) == 0 {
 		return nil
-	})
+	}
+
+	deletes := make([]string, 0, len(tx.deletes))
+	for name := range tx.deletes {
+		deletes = append(deletes, name)
+	}
+	// Memory follows the backend: a failed commit leaves both as they were.
+	if err := s.backend.Commit(tx.puts, deletes); err != nil {
+		return err
+	}
+	for _, name := range deletes {
+		delete(s.tracks, name)
+	}
+	for name, t := range tx.puts {
+		s.tracks[name] = t
+	}
+	return nil
 }
@@ -0,0 +1,71 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// schemaVersion is the library.json layout this build reads and writes. Bump
+// it together with a new entry in migrations whenever the layout changes in a
+// way an older build would misread; purely additive Track fields don't need it.
+const schemaVersion = 1
+
+// document is a library.json file decoded just far enough for migrations to
+// reshape it: top-level keys with their raw values.
+type document map[string]json.RawMessage
+
+// migrations[i] upgrades a document from version i to version i+1, so a file
+// at version v goes through migrations[v:] in order.
+var migrations = []func(doc document) error{
+	// 0 → 1: files written before the version field existed. The layout is
+	// the same; only the version stamp is new.
+	func(doc document) error { return nil },
+}
+
+// ErrNewerVersion is returned when library.json was written by a newer build.
+// The file is loaded as far as possible but never overwritten.
+var ErrNewerVersion = errors.New("library: file was written by a newer version")
+
+// decodeLibrary parses a library.json file of any known version, upgrading it
+// to schemaVersion. It returns the version the file was written at; for a
+// file newer than schemaVersion it returns ErrNewerVersion along with whatever
+// tracks could still be read.
+func decodeLibrary(data []byte) (map[string]Track, int, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	if doc == nil {
+		return nil, 0, errors.New("library: not a JSON object")
+	}
+
+	var version int
+	if raw, ok := doc["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("library: bad version: %w", err)
+		}
+	}
+	if version < 0 {
+		return nil, version, fmt.Errorf("library: bad version %d", version)
+	}
+
+	if version > schemaVersion {
+		var f fileFormat
+		json.Unmarshal(data, &f) // best effort: an unknown layout may not fit
+		return f.Tracks, version, fmt.Errorf("%w (v%d, this build understands up to v%d)", ErrNewerVersion, version, schemaVersion)
+	}
+	for v := version; v < schemaVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return nil, version, fmt.Errorf("library: migrate v%d to v%d: %w", v, v+1, err)
+		}
+	}
+
+	var tracks map[string]Track
+	if raw, ok := doc["tracks"]; ok {
+		if err := json.Unmarshal(raw, &tracks); err != nil {
+			return nil, version, err
+		}
+	}
+	return tracks, version, nil
+}
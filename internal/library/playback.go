@@ -0,0 +1,210 @@
+package library
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Progress is where listening to a file left off, shared by every device,
+// and how often it has been played.
+type Progress struct {
+	Position   float64   `json:"position"` // seconds
+	LastPlayed time.Time `json:"last_played,omitzero"`
+	Completed  bool      `json:"completed,omitempty"`
+	Plays      int       `json:"plays,omitempty"` // times played to the end
+	Skips      int       `json:"skips,omitempty"` // times skipped before the end
+}
+
+// PlayStatus summarizes Progress for filtering.
+type PlayStatus string
+
+const (
+	StatusUnplayed   PlayStatus = "unplayed"
+	StatusInProgress PlayStatus = "in_progress"
+	StatusPlayed     PlayStatus = "played"
+)
+
+// Valid reports whether s is a known status.
+func (s PlayStatus) Valid() bool {
+	return s == StatusUnplayed || s == StatusInProgress || s == StatusPlayed
+}
+
+// Status is played once the file was finished (or marked played), in progress
+// while there is a position to resume from, and unplayed otherwise.
+func (p Progress) Status() PlayStatus {
+	switch {
+	case p.Completed:
+		return StatusPlayed
+	case p.Position > 0:
+		return StatusInProgress
+	}
+	return StatusUnplayed
+}
+
+// PlayEvent is something a player reports about a file.
+type PlayEvent string
+
+const (
+	PlayStart    PlayEvent = "start"
+	PlayComplete PlayEvent = "complete"
+	PlaySkip     PlayEvent = "skip"
+)
+
+// Apply records event, reported at time now, on p.
+func (p *Progress) Apply(event PlayEvent, now time.Time) error {
+	switch event {
+	case PlayStart:
+	case PlayComplete:
+		p.Plays++
+		p.Completed = true
+		p.Position = 0
+	case PlaySkip:
+		p.Skips++
+	default:
+		return fmt.Errorf("unknown play event %q", event)
+	}
+	p.LastPlayed = now
+	return nil
+}
+
+// playbackFlushDelay is how long the PlaybackStore lets changes pile up
+// before writing them. Players report positions every few seconds, so
+// writing each one would rewrite the file constantly for nothing.
+const playbackFlushDelay = 10 * time.Second
+
+// PlaybackStore keeps per-file playback state in .ytdl2/playback.json,
+// separate from the library so frequent position updates don't rewrite it.
+// Changes are held in memory and written at most once per flush delay; call
+// Flush (or Close) before exiting.
+type PlaybackStore struct {
+	mu       sync.Mutex
+	file     *fsutil.JSONFile
+	delay    time.Duration
+	progress map[string]Progress
+	timer    *time.Timer // pending flush, nil if nothing is unsaved
+}
+
+type playbackFile struct {
+	Version  int                 `json:"version"`
+	Progress map[string]Progress `json:"progress"`
+}
+
+// LoadPlayback reads the playback file at path (missing means no state yet;
+// an unparseable one is set aside).
+func LoadPlayback(path string) *PlaybackStore {
+	ps := &PlaybackStore{file: fsutil.NewJSONFile(path), delay: playbackFlushDelay, progress: make(map[string]Progress)}
+	var f playbackFile
+	if err := ps.file.Load(&f); err != nil {
+		log.Printf("library: %v — starting without playback state", err)
+	}
+	if f.Progress != nil {
+		ps.progress = f.Progress
+	}
+	return ps
+}
+
+// Progress returns the playback state of name and whether there is any.
+func (ps *PlaybackStore) Progress(name string) (Progress, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, ok := ps.progress[name]
+	return p, ok
+}
+
+// AllProgress returns a copy of every file's playback state.
+func (ps *PlaybackStore) AllProgress() map[string]Progress {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return maps.Clone(ps.progress)
+}
+
+// UpdateProgress applies fn to name's playback state (the zero Progress if
+// there is none yet) and returns the result. If fn fails nothing changes;
+// otherwise the change is saved with the next flush.
+func (ps *PlaybackStore) UpdateProgress(name string, fn func(p *Progress) error) (Progress, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p := ps.progress[name]
+	if err := fn(&p); err != nil {
+		return ps.progress[name], err
+	}
+	ps.progress[name] = p
+	ps.changed()
+	return p, nil
+}
+
+// MarkPlayed marks every named file played or unplayed, clearing its resume
+// position either way. Play counts are kept.
+func (ps *PlaybackStore) MarkPlayed(names []string, played bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, name := range names {
+		p := ps.progress[name]
+		p.Completed = played
+		p.Position = 0
+		ps.progress[name] = p
+	}
+	ps.changed()
+}
+
+// Rename re-keys name's state after the file moved.
+func (ps *PlaybackStore) Rename(oldName, newName string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, ok := ps.progress[oldName]
+	if !ok {
+		return
+	}
+	delete(ps.progress, oldName)
+	ps.progress[newName] = p
+	ps.changed()
+}
+
+// Delete forgets name's state.
+func (ps *PlaybackStore) Delete(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if _, ok := ps.progress[name]; !ok {
+		return
+	}
+	delete(ps.progress, name)
+	ps.changed()
+}
+
+// changed schedules a flush unless one is already pending. ps.mu is held.
+func (ps *PlaybackStore) changed() {
+	if ps.timer == nil {
+		ps.timer = time.AfterFunc(ps.delay, func() {
+			if err := ps.Flush(); err != nil {
+				log.Printf("library: save %s: %v", ps.file.Path(), err)
+			}
+		})
+	}
+}
+
+// Flush writes any unsaved changes now. If writing fails the changes stay
+// pending and are retried after the flush delay.
+func (ps *PlaybackStore) Flush() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.timer == nil {
+		return nil
+	}
+	ps.timer.Stop()
+	ps.timer = nil
+	if err := ps.file.Save(playbackFile{Version: 1, Progress: ps.progress}); err != nil {
+		ps.changed()
+		return err
+	}
+	return nil
+}
+
+// Close flushes pending changes.
+func (ps *PlaybackStore) Close() error {
+	return ps.Flush()
+}
@@ -0,0 +1,224 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Playlist is a saved, ordered list of library files. A file may appear more
+// than once.
+type Playlist struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Entries   []PlaylistEntry `json:"entries"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// PlaylistEntry points at a file by name. Fingerprint, if the file had been
+// probed when it was added, lets the entry find the file again after it was
+// moved outside the API.
+type PlaylistEntry struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+var (
+	ErrPlaylistNotFound = errors.New("playlist not found")
+	ErrInvalidPlaylist  = errors.New("invalid playlist")
+)
+
+const (
+	maxPlaylistName    = 200
+	maxPlaylistEntries = 10000
+)
+
+func (p *Playlist) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > maxPlaylistName {
+		return fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidPlaylist, maxPlaylistName)
+	}
+	if len(p.Entries) > maxPlaylistEntries {
+		return fmt.Errorf("%w: at most %d entries", ErrInvalidPlaylist, maxPlaylistEntries)
+	}
+	return nil
+}
+
+// PlaylistStore is the set of saved playlists, kept in .ytdl2/playlists.json.
+type PlaylistStore struct {
+	mu        sync.Mutex
+	file      *fsutil.JSONFile
+	playlists []Playlist // in creation order
+}
+
+type playlistsFile struct {
+	Version   int        `json:"version"`
+	Playlists []Playlist `json:"playlists"`
+}
+
+// LoadPlaylists reads the playlist file at path (missing means none; an
+// unparseable one is set aside).
+func LoadPlaylists(path string) *PlaylistStore {
+	ps := &PlaylistStore{file: fsutil.NewJSONFile(path)}
+	var f playlistsFile
+	if err := ps.file.Load(&f); err != nil {
+		log.Printf("library: %v — starting without playlists", err)
+	}
+	ps.playlists = f.Playlists
+	return ps
+}
+
+// List returns every playlist, oldest first.
+func (ps *PlaylistStore) List() []Playlist {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return clonePlaylists(ps.playlists)
+}
+
+// Get returns one playlist.
+func (ps *PlaylistStore) Get(id string) (Playlist, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	i := ps.index(id)
+	if i < 0 {
+		return Playlist{}, ErrPlaylistNotFound
+	}
+	return clonePlaylist(ps.playlists[i]), nil
+}
+
+// Create saves a new playlist and returns it with its ID.
+func (ps *PlaylistStore) Create(name string, entries []PlaylistEntry) (Playlist, error) {
+	now := time.Now().UTC()
+	p := Playlist{ID: fsutil.NewID("p"), Name: name, Entries: entries, CreatedAt: now, UpdatedAt: now}
+	if p.Entries == nil {
+		p.Entries = []PlaylistEntry{}
+	}
+	if err := p.validate(); err != nil {
+		return p, err
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return p, ps.commit(append(clonePlaylists(ps.playlists), p))
+}
+
+// Update applies fn to a copy of the playlist and saves the result. If fn
+// fails nothing changes. The ID and creation time can't be changed.
+func (ps *PlaylistStore) Update(id string, fn func(p *Playlist) error) (Playlist, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	i := ps.index(id)
+	if i < 0 {
+		return Playlist{}, ErrPlaylistNotFound
+	}
+	p := clonePlaylist(ps.playlists[i])
+	if err := fn(&p); err != nil {
+		return p, err
+	}
+	p.ID, p.CreatedAt = id, ps.playlists[i].CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+	if err := p.validate(); err != nil {
+		return p, err
+	}
+	playlists := clonePlaylists(ps.playlists)
+	playlists[i] = p
+	return p, ps.commit(playlists)
+}
+
+// Delete removes a playlist.
+func (ps *PlaylistStore) Delete(id string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	i := ps.index(id)
+	if i < 0 {
+		return ErrPlaylistNotFound
+	}
+	return ps.commit(slices.Delete(clonePlaylists(ps.playlists), i, i+1))
+}
+
+// RenameFile points every entry for oldName at newName, after the file moved.
+func (ps *PlaylistStore) RenameFile(oldName, newName string) error {
+	return ps.rewrite(func(e PlaylistEntry) (PlaylistEntry, bool) {
+		if e.Name == oldName {
+			e.Name = newName
+		}
+		return e, true
+	})
+}
+
+// Repair re-points entries at the file find returns for them, e.g. where
+// their content is now, and saves once if anything changed. find returns ""
+// to leave an entry as it is.
+func (ps *PlaylistStore) Repair(find func(e PlaylistEntry) string) error {
+	return ps.rewrite(func(e PlaylistEntry) (PlaylistEntry, bool) {
+		if name := find(e); name != "" {
+			e.Name = name
+		}
+		return e, true
+	})
+}
+
+// RemoveFile drops every entry for name, after the file was deleted.
+func (ps *PlaylistStore) RemoveFile(name string) error {
+	return ps.rewrite(func(e PlaylistEntry) (PlaylistEntry, bool) {
+		return e, e.Name != name
+	})
+}
+
+// rewrite passes every entry of every playlist through fn, which returns the
+// new entry and whether to keep it, and saves if anything changed.
+func (ps *PlaylistStore) rewrite(fn func(e PlaylistEntry) (PlaylistEntry, bool)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	playlists := clonePlaylists(ps.playlists)
+	changed := false
+	for i := range playlists {
+		entries := playlists[i].Entries[:0]
+		for _, e := range playlists[i].Entries {
+			ne, keep := fn(e)
+			if !keep || ne != e {
+				changed = true
+			}
+			if keep {
+				entries = append(entries, ne)
+			}
+		}
+		playlists[i].Entries = entries
+	}
+	if !changed {
+		return nil
+	}
+	return ps.commit(playlists)
+}
+
+func (ps *PlaylistStore) index(id string) int {
+	return slices.IndexFunc(ps.playlists, func(p Playlist) bool { return p.ID == id })
+}
+
+// commit saves playlists and, once saved, makes them current.
+func (ps *PlaylistStore) commit(playlists []Playlist) error {
+	if err := ps.file.Save(playlistsFile{Version: 1, Playlists: playlists}); err != nil {
+		return err
+	}
+	ps.playlists = playlists
+	return nil
+}
+
+func clonePlaylist(p Playlist) Playlist {
+	p.Entries = slices.Clone(p.Entries)
+	return p
+}
+
+func clonePlaylists(playlists []Playlist) []Playlist {
+	out := make([]Playlist, len(playlists))
+	for i, p := range playlists {
+		out[i] = clonePlaylist(p)
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Metadata is what the file's own tags say about it.
+type Metadata struct {
+	Title   string `json:"title,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Track   string `json:"track,omitempty"` // as tagged, e.g. "3" or "3/12"
+	Date    string `json:"date,omitempty"`
+	Genre   string `json:"genre,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	URL     string `json:"url,omitempty"` // source page, from a purl or comment tag
+}
+
+// Format describes the primary audio stream.
+type Format struct {
+	Codec      string `json:"codec,omitempty"`
+	Bitrate    int64  `json:"bitrate,omitempty"` // bits per second
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+}
+
+// Probe is everything one ffprobe call tells us about a file.
+type Probe struct {
+	Duration float64 // seconds
+	Meta     Metadata
+	Format   Format
+}
+
+// ProbeFile reads duration, tags and audio format via a single ffprobe call.
+// A non-media file or a missing ffprobe yields an error; callers should skip.
+func ProbeFile(path string) (Probe, error) {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration,bit_rate:format_tags:stream=codec_type,codec_name,sample_rate,channels,bit_rate:stream_tags",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return Probe{}, fmt.Errorf("ffprobe %q: %w", path, err)
+	}
+	return parseProbe(out)
+}
+
+// ffprobeOutput mirrors the subset of `ffprobe -of json` we ask for. Numbers
+// come back as strings.
+type ffprobeOutput struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType  string            `json:"codec_type"`
+		CodecName  string            `json:"codec_name"`
+		SampleRate string            `json:"sample_rate"`
+		Channels   int               `json:"channels"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"streams"`
+}
+
+func parseProbe(data []byte) (Probe, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Probe{}, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+
+	var p Probe
+	d, err := strconv.ParseFloat(strings.TrimSpace(out.Format.Duration), 64)
+	if err != nil {
+		return Probe{}, fmt.Errorf("parse duration %q: %w", out.Format.Duration, err)
+	}
+	p.Duration = d
+
+	// Container tags win; Ogg/Opus keep theirs on the stream instead.
+	tags := lowerKeys(out.Format.Tags)
+	for _, st := range out.Streams {
+		if st.CodecType != "audio" {
+			continue
+		}
+		p.Format.Codec = st.CodecName
+		p.Format.SampleRate, _ = strconv.Atoi(st.SampleRate)
+		p.Format.Channels = st.Channels
+		p.Format.Bitrate, _ = strconv.ParseInt(st.BitRate, 10, 64)
+		for k, v := range lowerKeys(st.Tags) {
+			if _, ok := tags[k]; !ok {
+				tags[k] = v
+			}
+		}
+		break
+	}
+	if p.Format.Bitrate == 0 {
+		p.Format.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+	}
+
+	p.Meta = Metadata{
+		Title:   tags["title"],
+		Artist:  firstNonEmpty(tags["artist"], tags["album_artist"]),
+		Album:   tags["album"],
+		Track:   tags["track"],
+		Date:    firstNonEmpty(tags["date"], tags["year"]),
+		Genre:   tags["genre"],
+		Comment: firstNonEmpty(tags["comment"], tags["description"]),
+		URL:     firstURL(tags["purl"], tags["comment"], tags["url"]),
+	}
+	return p, nil
+}
+
+func lowerKeys(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// firstURL returns the first value that is an http(s) URL.
+func firstURL(vs ...string) string {
+	for _, v := range vs {
+		if strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://") {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(vs ...string) string {
+	for _, v := range vs {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package library
+
+import "testing"
+
+func TestParseProbe(t *testing.T) {
+	out := []byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "mjpeg"},
+			{"codec_type": "audio", "codec_name": "mp3", "sample_rate": "44100", "channels": 2, "bit_rate": "192000",
+			 "tags": {"TITLE": "ignored: container wins"}}
+		],
+		"format": {
+			"duration": "245.315918",
+			"bit_rate": "198765",
+			"tags": {"TITLE": "Song", "artist": "Band", "album": "LP", "track": "3/12", "YEAR": "2019", "genre": "Rock", "comment": " hi ", "purl": "https://www.youtube.com/watch?v=abc"}
+		}
+	}`)
+	p, err := parseProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Duration != 245.315918 {
+		t.Fatalf("duration = %v", p.Duration)
+	}
+	wantMeta := Metadata{Title: "Song", Artist: "Band", Album: "LP", Track: "3/12", Date: "2019", Genre: "Rock", Comment: "hi", URL: "https://www.youtube.com/watch?v=abc"}
+	if p.Meta != wantMeta {
+		t.Fatalf("meta = %+v, want %+v", p.Meta, wantMeta)
+	}
+	wantFormat := Format{Codec: "mp3", Bitrate: 192000, SampleRate: 44100, Channels: 2}
+	if p.Format != wantFormat {
+		t.Fatalf("format = %+v, want %+v", p.Format, wantFormat)
+	}
+}
+
+func TestParseProbeStreamTagsAndNoDuration(t *testing.T) {
+	p, err := parseProbe([]byte(`{"streams":[{"codec_type":"audio","codec_name":"opus","tags":{"title":"Episode 4"}}],
+		"format":{"duration":"60.0","bit_rate":"64000"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Meta.Title != "Episode 4" || p.Format.Bitrate != 64000 {
+		t.Fatalf("probe = %+v", p)
+	}
+	if _, err := parseProbe([]byte(`{"format":{}}`)); err == nil {
+		t.Fatal("missing duration should fail")
+	}
+}
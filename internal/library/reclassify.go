@@ -0,0 +1,42 @@
+package library
+
+import "sort"
+
+// Reclassification is one guessed category that re-guessing changes.
+type Reclassification struct {
+	Name     string   `json:"name"`
+	Duration float64  `json:"duration"`
+	From     Category `json:"from"`
+	To       Category `json:"to"`
+	Rule     string   `json:"rule,omitempty"` // ID of the deciding rule; empty for the duration fallback
+}
+
+// Reclassify re-guesses the category of every SourceGuessed track with rules
+// and the given threshold, leaving manual categories alone. With dryRun
+// nothing is stored; either way the changes are returned, by name.
+func (s *Store) Reclassify(rules *RuleStore, thresholdSeconds float64, dryRun bool) ([]Reclassification, error) {
+	changes := []Reclassification{}
+	err := s.Batch(func(tx *Tx) error {
+		for _, name := range tx.Names() {
+			t, _ := tx.Get(name)
+			if t.Source != SourceGuessed || t.Duration <= 0 {
+				continue
+			}
+			to, rule := rules.Classify(name, t, thresholdSeconds)
+			if to == t.Category {
+				continue
+			}
+			changes = append(changes, Reclassification{Name: name, Duration: t.Duration, From: t.Category, To: to, Rule: rule})
+			if !dryRun {
+				t.Category = to
+				tx.Put(name, t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
@@ -0,0 +1,197 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fingerprintChunk is how much of each end of a file Fingerprint reads.
+const fingerprintChunk = 64 << 10
+
+// Fingerprint is a fast content hash: SHA-256 over the file size and its first
+// and last 64 KiB. Two files with the same size and fingerprint are, for a
+// media library, the same file; it is cheap enough to compute on every scan.
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, info.Size())
+	if _, err := io.CopyN(h, f, fingerprintChunk); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info.Size() > 2*fingerprintChunk {
+		if _, err := f.Seek(-fingerprintChunk, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	} else if info.Size() > fingerprintChunk {
+		if _, err := io.Copy(h, f); err != nil { // the rest, read once
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listFiles maps the relative name of every non-hidden file under dir to its
+// size. Hidden files and folders (including the .ytdl2 sidecar dir) are skipped.
+func listFiles(dir string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return nil // tolerate unreadable entries
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		sizes[rel] = info.Size()
+		return nil
+	})
+	return sizes, err
+}
+
+// Rename is one re-attached entry: metadata stored for From now belongs to To.
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ReconcileReport says what a reconcile pass changed.
+type ReconcileReport struct {
+	Pruned        []string `json:"pruned"`        // entries whose file is gone
+	Renamed       []Rename `json:"renamed"`       // entries re-attached to a renamed file
+	Fingerprinted int      `json:"fingerprinted"` // entries whose fingerprint was (re)computed
+}
+
+// guessedOnly reports whether t holds nothing a scan couldn't work out again:
+// no manual category, tags, chapters or feed episode.
+func (t Track) guessedOnly() bool {
+	return t.Source != SourceManual && len(t.Tags) == 0 && len(t.Chapters) == 0 && t.Episode == nil
+}
+
+// Reconcile brings the store in line with the files under dir. Entries for
+// files that were renamed outside the API are moved to the new name (matched by
+// size and fingerprint), replacing an entry a scan already guessed for it;
+// entries for files that are gone are removed; present files get their
+// fingerprint recorded so future renames can be matched. All changes are
+// committed in one batch.
+func (s *Store) Reconcile(dir string) (ReconcileReport, error) {
+	report := ReconcileReport{Pruned: []string{}, Renamed: []Rename{}}
+
+	sizes, err := listFiles(dir)
+	if err != nil {
+		return report, err
+	}
+
+	snapshot := s.All()
+
+	// Fingerprinting reads files, so it happens without holding the lock.
+	type fp struct {
+		size int64
+		sum  string
+	}
+	backfill := make(map[string]fp)
+	orphans := make(map[fp][]string)
+	orphanSizes := make(map[int64]bool)
+	var pruned []string
+	for name, t := range snapshot {
+		size, present := sizes[name]
+		switch {
+		case present && (t.Fingerprint == "" || t.Size != size):
+			if sum, err := Fingerprint(filepath.Join(dir, name)); err == nil {
+				backfill[name] = fp{size, sum}
+			}
+		case !present && t.Fingerprint != "":
+			key := fp{t.Size, t.Fingerprint}
+			orphans[key] = append(orphans[key], name)
+			orphanSizes[t.Size] = true
+		case !present:
+			pruned = append(pruned, name)
+		}
+	}
+	var renames []Rename
+	for name, size := range sizes {
+		if t, known := snapshot[name]; (known && !t.guessedOnly()) || !orphanSizes[size] {
+			continue
+		}
+		sum, err := Fingerprint(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		key := fp{size, sum}
+		if from := orphans[key]; len(from) > 0 {
+			renames = append(renames, Rename{From: from[0], To: name})
+			orphans[key] = from[1:]
+		}
+	}
+	for _, names := range orphans {
+		pruned = append(pruned, names...)
+	}
+
+	// Apply, re-checking against the live map: the API may have changed
+	// things while we were hashing.
+	err = s.Batch(func(tx *Tx) error {
+		for name, f := range backfill {
+			t, ok := tx.Get(name)
+			if !ok {
+				continue
+			}
+			if t.Fingerprint != f.sum {
+				t.SHA256 = "" // content changed; the full hash is stale
+			}
+			t.Size, t.Fingerprint = f.size, f.sum
+			tx.Put(name, t)
+			report.Fingerprinted++
+		}
+		for _, r := range renames {
+			t, ok := tx.Get(r.From)
+			if cur, taken := tx.Get(r.To); !ok || (taken && !cur.guessedOnly()) {
+				continue
+			}
+			tx.Delete(r.From)
+			tx.Put(r.To, t)
+			report.Renamed = append(report.Renamed, r)
+		}
+		for _, name := range pruned {
+			if _, ok := tx.Get(name); !ok {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+				continue // reappeared (e.g. moved back through the API)
+			}
+			tx.Delete(name)
+			report.Pruned = append(report.Pruned, name)
+		}
+		return nil
+	})
+	return report, err
+}
@@ -0,0 +1,340 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Rule files matching tracks under a category when guessing. Rules are tried
+// in order and the first match wins; if none matches, the categories' own
+// duration rules and then the threshold decide (see RuleStore.Classify).
+type Rule struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"` // what it's for, shown in the UI
+	Category Category `json:"category"`
+	Disabled bool     `json:"disabled,omitempty"`
+	Match    Match    `json:"match"`
+}
+
+// Match is a rule's conditions. Every condition that is set must hold. Text
+// patterns are case-insensitive regular expressions.
+type Match struct {
+	MinSeconds float64 `json:"min_seconds,omitempty"` // duration >= this
+	MaxSeconds float64 `json:"max_seconds,omitempty"` // duration < this
+	Domain     string  `json:"domain,omitempty"`      // source site, e.g. "youtube.com"; subdomains match too
+	Uploader   string  `json:"uploader,omitempty"`    // pattern for the uploader/channel (artist tag)
+	Title      string  `json:"title,omitempty"`       // pattern for the title tag
+	Filename   string  `json:"filename,omitempty"`    // pattern for the file name, without folders
+	Folder     string  `json:"folder,omitempty"`      // file is in this folder or below
+	Tag        string  `json:"tag,omitempty"`         // track carries this tag
+}
+
+// compiledRule is a Rule with its patterns parsed.
+type compiledRule struct {
+	Rule
+	uploader, title, filename *regexp.Regexp
+}
+
+var (
+	ErrRuleNotFound = errors.New("rule not found")
+	ErrInvalidRule  = errors.New("invalid rule")
+)
+
+// validate checks a new or edited rule, including that its category exists.
+func (r Rule) validate(categories *CategoryStore) (*compiledRule, error) {
+	if !categories.Valid(r.Category) {
+		return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidRule, r.Category)
+	}
+	return r.compile()
+}
+
+// compile checks r's conditions and parses its patterns. A saved rule whose
+// category has since been deleted still compiles; Classify skips it.
+func (r Rule) compile() (*compiledRule, error) {
+	m := r.Match
+	if m == (Match{}) {
+		return nil, fmt.Errorf("%w: no conditions", ErrInvalidRule)
+	}
+	if m.MinSeconds < 0 || m.MaxSeconds < 0 || (m.MaxSeconds != 0 && m.MaxSeconds <= m.MinSeconds) {
+		return nil, fmt.Errorf("%w: need 0 <= min_seconds < max_seconds (or no max_seconds)", ErrInvalidRule)
+	}
+	c := &compiledRule{Rule: r}
+	for _, p := range []struct {
+		field, pattern string
+		re             **regexp.Regexp
+	}{
+		{"uploader", m.Uploader, &c.uploader},
+		{"title", m.Title, &c.title},
+		{"filename", m.Filename, &c.filename},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + p.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRule, p.field, err)
+		}
+		*p.re = re
+	}
+	return c, nil
+}
+
+// matches reports whether the track stored under name satisfies every
+// condition of the rule.
+func (c *compiledRule) matches(name string, t Track) bool {
+	m := c.Match
+	if (m.MinSeconds > 0 || m.MaxSeconds > 0) && !(DurationRule{m.MinSeconds, m.MaxSeconds}).Matches(t.Duration) {
+		return false
+	}
+	if m.Domain != "" && !domainMatches(t.Meta.URL, m.Domain) {
+		return false
+	}
+	if c.uploader != nil && !c.uploader.MatchString(t.Meta.Artist) {
+		return false
+	}
+	if c.title != nil && !c.title.MatchString(t.Meta.Title) {
+		return false
+	}
+	slashed := filepath.ToSlash(name)
+	if c.filename != nil && !c.filename.MatchString(slashed[strings.LastIndex(slashed, "/")+1:]) {
+		return false
+	}
+	if m.Folder != "" {
+		folder := strings.Trim(filepath.ToSlash(m.Folder), "/")
+		if !strings.HasPrefix(slashed, folder+"/") {
+			return false
+		}
+	}
+	if m.Tag != "" && !slices.ContainsFunc(t.Tags, func(tag string) bool { return strings.EqualFold(tag, m.Tag) }) {
+		return false
+	}
+	return true
+}
+
+// domainMatches reports whether rawURL's host is domain or a subdomain of it.
+func domainMatches(rawURL, domain string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Classify guesses a category for the track stored under name: the first
+// enabled rule that matches, else the categories' Classify by duration —
+// except that a confident speech analysis overrides the threshold's
+// music/podcast split. It also returns the ID of the rule that decided (""
+// for the fallback). A nil store has no rules and just the built-in
+// categories.
+func (rs *RuleStore) Classify(name string, t Track, thresholdSeconds float64) (Category, string) {
+	var rules []*compiledRule
+	var categories *CategoryStore
+	if rs != nil {
+		rs.mu.Lock()
+		rules, categories = rs.compiled, rs.categories
+		rs.mu.Unlock()
+	}
+	for _, r := range rules {
+		if !r.Disabled && categories.Valid(r.Category) && r.matches(name, t) {
+			return r.Category, r.ID
+		}
+	}
+	c := categories.Classify(t.Duration, thresholdSeconds)
+	if c.Builtin() {
+		if heard, ok := t.Speech.Category(); ok {
+			return heard, ""
+		}
+	}
+	return c, ""
+}
+
+// Test reports which tracks (by name) r matches on its own, ignoring the
+// saved rules. r need not be saved.
+func (rs *RuleStore) Test(r Rule, tracks map[string]Track) ([]string, error) {
+	c, err := r.validate(rs.categories)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name, t := range tracks {
+		if c.matches(name, t) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// RuleStore is the ordered, user-managed rule list, kept in
+// .ytdl2/rules.json.
+type RuleStore struct {
+	mu         sync.Mutex
+	file       *fsutil.JSONFile
+	categories *CategoryStore // rules may only file under these
+	rules      []Rule
+	compiled   []*compiledRule // the rules that compile, in order; replaced on every change
+}
+
+type rulesFile struct {
+	Version int    `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+// LoadRules reads the rule file at path (missing means no rules; an
+// unparseable one is set aside). Rules that no longer compile are kept but
+// skipped. Rules must name one of categories.
+func LoadRules(path string, categories *CategoryStore) *RuleStore {
+	rs := &RuleStore{file: fsutil.NewJSONFile(path), categories: categories}
+	var f rulesFile
+	if err := rs.file.Load(&f); err != nil {
+		log.Printf("library: %v — starting without rules", err)
+	}
+	rs.rules = f.Rules
+	rs.compile()
+	return rs
+}
+
+// List returns the rules in evaluation order.
+func (rs *RuleStore) List() []Rule {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return slices.Clone(rs.rules)
+}
+
+// Create adds r at position (appended if position is out of range) and
+// returns it with its new ID.
+func (rs *RuleStore) Create(r Rule, position int) (Rule, error) {
+	r.ID = fsutil.NewID("r")
+	if _, err := r.validate(rs.categories); err != nil {
+		return r, err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if position < 0 || position > len(rs.rules) {
+		position = len(rs.rules)
+	}
+	return r, rs.commit(slices.Insert(slices.Clone(rs.rules), position, r))
+}
+
+// Replace overwrites the rule with r's ID, keeping its position.
+func (rs *RuleStore) Replace(r Rule) (Rule, error) {
+	if _, err := r.validate(rs.categories); err != nil {
+		return r, err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	i := rs.index(r.ID)
+	if i < 0 {
+		return r, ErrRuleNotFound
+	}
+	rules := slices.Clone(rs.rules)
+	rules[i] = r
+	return r, rs.commit(rules)
+}
+
+// Delete removes a rule.
+func (rs *RuleStore) Delete(id string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	i := rs.index(id)
+	if i < 0 {
+		return ErrRuleNotFound
+	}
+	return rs.commit(slices.Delete(slices.Clone(rs.rules), i, i+1))
+}
+
+// Reorder sets the evaluation order. ids must name every rule exactly once.
+func (rs *RuleStore) Reorder(ids []string) ([]Rule, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if len(ids) != len(rs.rules) {
+		return nil, fmt.Errorf("%w: order must list all %d rules", ErrInvalidRule, len(rs.rules))
+	}
+	rules := make([]Rule, 0, len(ids))
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		i := rs.index(id)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: no rule %q", ErrInvalidRule, id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: %q listed twice", ErrInvalidRule, id)
+		}
+		seen[id] = true
+		rules = append(rules, rs.rules[i])
+	}
+	if err := rs.commit(rules); err != nil {
+		return nil, err
+	}
+	return slices.Clone(rules), nil
+}
+
+// Using returns the IDs of the rules that file under c.
+func (rs *RuleStore) Using(c Category) []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var ids []string
+	for _, r := range rs.rules {
+		if r.Category == c {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// Reassign points every rule that files under from at to instead.
+func (rs *RuleStore) Reassign(from, to Category) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rules := slices.Clone(rs.rules)
+	changed := false
+	for i := range rules {
+		if rules[i].Category == from {
+			rules[i].Category = to
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return rs.commit(rules)
+}
+
+func (rs *RuleStore) index(id string) int {
+	return slices.IndexFunc(rs.rules, func(r Rule) bool { return r.ID == id })
+}
+
+// commit saves rules and, once saved, makes them current.
+func (rs *RuleStore) commit(rules []Rule) error {
+	if err := rs.file.Save(rulesFile{Version: 1, Rules: rules}); err != nil {
+		return err
+	}
+	rs.rules = rules
+	rs.compile()
+	return nil
+}
+
+// compile parses the current rules for Classify.
+func (rs *RuleStore) compile() {
+	compiled := make([]*compiledRule, 0, len(rs.rules))
+	for _, r := range rs.rules {
+		c, err := r.compile()
+		if err != nil {
+			log.Printf("library: skipping rule %s: %v", r.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	rs.compiled = compiled
+}
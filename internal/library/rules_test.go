@@ -0,0 +1,83 @@
+package library
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRuleConditions(t *testing.T) {
+	track := Track{
+		Duration: 420,
+		Meta:     Metadata{Title: "Daily News - Oct 3", Artist: "NewsChannel", URL: "https://m.youtube.com/watch?v=x"},
+		Tags:     []string{"Workout"},
+	}
+	name := "Shows/News/daily-news.mp3"
+	for _, tc := range []struct {
+		match Match
+		want  bool
+	}{
+		{Match{MinSeconds: 300, MaxSeconds: 600}, true},
+		{Match{MaxSeconds: 400}, false},
+		{Match{Domain: "youtube.com"}, true},
+		{Match{Domain: "tube.com"}, false},
+		{Match{Uploader: "^newschannel$"}, true},
+		{Match{Title: `news - \w+ \d+`}, true},
+		{Match{Filename: `^daily-`}, true},
+		{Match{Filename: `^Shows`}, false}, // the folder isn't part of the file name
+		{Match{Folder: "Shows"}, true},
+		{Match{Folder: "Show"}, false},
+		{Match{Tag: "workout"}, true},
+		{Match{Tag: "workout", MaxSeconds: 60}, false}, // every condition must hold
+	} {
+		c, err := Rule{Category: CategoryPodcast, Match: tc.match}.compile()
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.match, err)
+		}
+		if got := c.matches(name, track); got != tc.want {
+			t.Errorf("%+v matches = %v, want %v", tc.match, got, tc.want)
+		}
+	}
+}
+
+func TestRuleOrderAndFallback(t *testing.T) {
+	rs := LoadRules(filepath.Join(t.TempDir(), "rules.json"), nil)
+
+	long, err := rs.Create(Rule{Category: CategoryMusic, Match: Match{Uploader: "Band"}}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := rs.Create(Rule{Category: CategoryPodcast, Match: Match{Title: "interview"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Create(Rule{Category: "nope", Match: Match{Title: "x"}}, -1); err == nil {
+		t.Fatal("rule for an unknown category accepted")
+	}
+	if _, err := rs.Create(Rule{Category: CategoryMusic}, -1); err == nil {
+		t.Fatal("rule without conditions accepted")
+	}
+
+	interview := Track{Duration: 200, Meta: Metadata{Title: "Interview", Artist: "Band"}}
+	if got, rule := rs.Classify("a.mp3", interview, 360); got != CategoryPodcast || rule != first.ID {
+		t.Fatalf("interview = %s by %q", got, rule)
+	}
+	if _, err := rs.Reorder([]string{long.ID, first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got, rule := rs.Classify("a.mp3", interview, 360); got != CategoryMusic || rule != long.ID {
+		t.Fatalf("after reorder = %s by %q", got, rule)
+	}
+	if got, rule := rs.Classify("b.mp3", Track{Duration: 4000}, 360); got != CategoryPodcast || rule != "" {
+		t.Fatalf("fallback = %s by %q", got, rule)
+	}
+
+	// Another store's rules don't apply.
+	if got, rule := LoadRules(filepath.Join(t.TempDir(), "rules.json"), nil).Classify("a.mp3", interview, 360); got != CategoryMusic || rule != "" {
+		t.Fatalf("empty store = %s by %q", got, rule)
+	}
+
+	// Reloading restores the same order.
+	if got := LoadRules(rs.file.Path(), nil).List(); len(got) != 2 || got[0].ID != long.ID {
+		t.Fatalf("reloaded = %+v", got)
+	}
+}
@@ -0,0 +1,367 @@
+package library
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanBatchSize is how many probed files a scan commits at once, so a first
+// scan of a large library doesn't rewrite the store per file.
+const scanBatchSize = 50
+
+// defaultScanWorkers bounds how many ffprobe processes a scan runs at once.
+const defaultScanWorkers = 4
+
+// ScanStatus describes the running scan, or the last one if none is running.
+type ScanStatus struct {
+	Running    bool      `json:"running"`
+	Pending    bool      `json:"pending"` // another scan is queued behind this one
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Seen       int       `json:"seen"`   // files looked at
+	Queued     int       `json:"queued"` // of those, files that need probing
+	Probed     int       `json:"probed"`
+	Failed     int       `json:"failed"`               // not media, or ffprobe failed
+	ETASeconds float64   `json:"eta_seconds,omitzero"` // rough, from the probe rate so far
+}
+
+// scanJob is what a scan covers; requests made while a scan runs are merged
+// into one follow-up job.
+type scanJob struct {
+	all   bool            // walk the whole tree
+	force bool            // re-probe files that look unchanged too
+	paths map[string]bool // probe these regardless
+}
+
+type queuedScan struct {
+	job  scanJob
+	done chan struct{}
+}
+
+// probed is a scan result waiting to be committed.
+type probed struct {
+	name        string
+	probe       Probe
+	speech      Speech // zero unless analyzed
+	size        int64
+	fingerprint string
+}
+
+// Scanner probes files in a directory into a Store: duration, embedded tags
+// and audio format, plus a guessed category unless one is set. At most one
+// scan runs at a time, probing with a bounded pool of workers; scans asked for
+// while one is running are coalesced into a single follow-up. Results are
+// committed in batches, so an interrupted scan keeps what it finished and the
+// next one carries on with the rest.
+type Scanner struct {
+	store *Store
+	dir   string
+
+	// Threshold returns the current category threshold in seconds.
+	Threshold func() float64
+	// Rules guess the category of new tracks; nil means just the duration
+	// split between the built-in categories.
+	Rules *RuleStore
+	// Workers is the number of concurrent probes (default 4).
+	Workers int
+	// OnProbed, if set, is called from a worker after each successful probe,
+	// e.g. to extract artwork alongside.
+	OnProbed func(name, path string)
+	// Speech, if set and returning true, has each probed track analyzed
+	// with AnalyzeSpeech as well.
+	Speech func() bool
+
+	probe   func(path string) (Probe, error)                    // ProbeFile; swapped in tests
+	analyze func(path string, duration float64) (Speech, error) // AnalyzeSpeech; swapped in tests
+
+	mu      sync.Mutex
+	running bool
+	next    *queuedScan
+	status  ScanStatus
+
+	failed map[string]int64 // name -> size it failed at; only touched by the scan loop
+}
+
+// NewScanner returns a scanner for the files under dir.
+func NewScanner(store *Store, dir string, threshold func() float64) *Scanner {
+	return &Scanner{
+		store:     store,
+		dir:       dir,
+		Threshold: threshold,
+		Workers:   defaultScanWorkers,
+		probe:     ProbeFile,
+		analyze:   AnalyzeSpeech,
+		failed:    make(map[string]int64),
+	}
+}
+
+// ScanAll queues a scan of the whole tree and returns a channel closed when
+// it has finished. Only files that are new, changed size, or were never fully
+// probed are probed, unless force is set; files that failed to probe are not
+// retried until they change.
+func (sc *Scanner) ScanAll(force bool) <-chan struct{} {
+	return sc.enqueue(scanJob{all: true, force: force})
+}
+
+// ScanPaths queues a probe of just the named files (relative to the scan dir),
+// e.g. ones a watcher saw change, and returns a channel closed when done.
+func (sc *Scanner) ScanPaths(names []string) <-chan struct{} {
+	job := scanJob{paths: make(map[string]bool, len(names))}
+	for _, name := range names {
+		job.paths[name] = true
+	}
+	return sc.enqueue(job)
+}
+
+// Status returns the progress of the running (or last) scan.
+func (sc *Scanner) Status() ScanStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	st := sc.status
+	st.Pending = sc.next != nil
+	if st.Running {
+		if done := st.Probed + st.Failed; done > 0 && done < st.Queued {
+			perFile := time.Since(st.StartedAt).Seconds() / float64(done)
+			st.ETASeconds = perFile * float64(st.Queued-done)
+		}
+	}
+	return st
+}
+
+func (sc *Scanner) enqueue(job scanJob) <-chan struct{} {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.next == nil {
+		sc.next = &queuedScan{job: scanJob{paths: make(map[string]bool)}, done: make(chan struct{})}
+	}
+	next := &sc.next.job
+	next.all = next.all || job.all
+	next.force = next.force || job.force
+	for name := range job.paths {
+		next.paths[name] = true
+	}
+	done := sc.next.done
+	if !sc.running {
+		sc.running = true
+		go sc.loop()
+	}
+	return done
+}
+
+func (sc *Scanner) loop() {
+	for {
+		sc.mu.Lock()
+		q := sc.next
+		sc.next = nil
+		if q == nil {
+			sc.running = false
+			sc.mu.Unlock()
+			return
+		}
+		sc.mu.Unlock()
+
+		sc.run(q.job)
+		close(q.done)
+	}
+}
+
+// run performs one scan: pick the files to probe, probe them on the worker
+// pool and commit the results in batches.
+func (sc *Scanner) run(job scanJob) {
+	sc.setStatus(func(st *ScanStatus) {
+		*st = ScanStatus{Running: true, StartedAt: time.Now()}
+	})
+	defer sc.setStatus(func(st *ScanStatus) {
+		st.Running = false
+		st.FinishedAt = time.Now()
+	})
+
+	sizes := make(map[string]int64)
+	if job.all {
+		all, err := listFiles(sc.dir)
+		if err == nil {
+			sizes = all
+		}
+	}
+	for name := range job.paths {
+		if _, ok := sizes[name]; ok || hidden(name) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(sc.dir, name))
+		if err != nil || !info.Mode().IsRegular() {
+			delete(sc.failed, name)
+			continue // gone again, or not a file
+		}
+		sizes[name] = info.Size()
+	}
+
+	var todo []string
+	for name, size := range sizes {
+		if sc.needsProbe(name, size, job) {
+			todo = append(todo, name)
+		}
+	}
+	sc.setStatus(func(st *ScanStatus) {
+		st.Seen = len(sizes)
+		st.Queued = len(todo)
+	})
+	if len(todo) == 0 {
+		return
+	}
+
+	type result struct {
+		name string
+		p    probed
+		err  error
+	}
+	names := make(chan string)
+	results := make(chan result)
+	workers := sc.Workers
+	if workers <= 0 {
+		workers = defaultScanWorkers
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				p, err := sc.probeOne(name)
+				results <- result{name, p, err}
+			}
+		}()
+	}
+	go func() {
+		for _, name := range todo {
+			names <- name
+		}
+		close(names)
+		wg.Wait()
+		close(results)
+	}()
+
+	var pending []probed
+	for r := range results {
+		if r.err != nil {
+			sc.failed[r.name] = sizes[r.name]
+			sc.setStatus(func(st *ScanStatus) { st.Failed++ })
+			continue
+		}
+		delete(sc.failed, r.name)
+		pending = append(pending, r.p)
+		sc.setStatus(func(st *ScanStatus) { st.Probed++ })
+		if len(pending) >= scanBatchSize {
+			sc.commit(pending)
+			pending = pending[:0]
+		}
+	}
+	sc.commit(pending)
+}
+
+// needsProbe reports whether a scan should probe name, currently size bytes.
+func (sc *Scanner) needsProbe(name string, size int64, job scanJob) bool {
+	if job.force || job.paths[name] {
+		return true
+	}
+	if t, ok := sc.store.Get(name); ok && t.Category != "" && (t.Format != (Format{}) || t.NoAudio) &&
+		(t.Size == 0 || t.Size == size) {
+		return false // already classified and probed, and unchanged
+	}
+	if failedAt, ok := sc.failed[name]; ok && failedAt == size {
+		return false // failed before and hasn't changed since
+	}
+	return true
+}
+
+var errNoDuration = errors.New("library: no duration")
+
+// probeOne probes and fingerprints one file. Files without a duration (not
+// media) count as failures so they stay untagged until a manual override.
+func (sc *Scanner) probeOne(name string) (probed, error) {
+	path := filepath.Join(sc.dir, name)
+	p, err := sc.probe(path)
+	if err != nil {
+		return probed{}, err // not media, or ffprobe missing
+	}
+	if p.Duration <= 0 {
+		return probed{}, errNoDuration
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return probed{}, err
+	}
+	sum, err := Fingerprint(path)
+	if err != nil {
+		return probed{}, err
+	}
+	var speech Speech
+	if sc.Speech != nil && sc.Speech() && p.Duration >= speechMinLength {
+		// Optional: a track that can't be analyzed is still probed.
+		if speech, err = sc.analyze(path, p.Duration); err != nil {
+			log.Printf("library: analyze %s: %v", name, err)
+		}
+	}
+	if sc.OnProbed != nil {
+		sc.OnProbed(name, path)
+	}
+	return probed{name: name, probe: p, speech: speech, size: info.Size(), fingerprint: sum}, nil
+}
+
+// commit stores a batch of results in one write.
+func (sc *Scanner) commit(results []probed) {
+	if len(results) == 0 {
+		return
+	}
+	threshold := sc.Threshold()
+	now := time.Now().UTC().Truncate(time.Second)
+	_ = sc.store.Batch(func(tx *Tx) error {
+		for _, r := range results {
+			t, _ := tx.Get(r.name)
+			if t.Added.IsZero() && t.Fingerprint == "" {
+				t.Added = now
+			}
+			if t.Fingerprint != r.fingerprint {
+				// New content: the full hash and speech analysis are stale.
+				t.SHA256 = ""
+				t.Speech = Speech{}
+			}
+			t.Size = r.size
+			t.Fingerprint = r.fingerprint
+			t.Duration = r.probe.Duration
+			t.Meta = r.probe.Meta
+			t.Format = r.probe.Format
+			t.NoAudio = r.probe.Format.Codec == ""
+			if r.speech.Windows > 0 {
+				t.Speech = r.speech
+			}
+			if t.Category == "" {
+				t.Category, _ = sc.Rules.Classify(r.name, t, threshold)
+				t.Source = SourceGuessed
+			}
+			tx.Put(r.name, t)
+		}
+		return nil
+	})
+}
+
+func (sc *Scanner) setStatus(fn func(st *ScanStatus)) {
+	sc.mu.Lock()
+	fn(&sc.status)
+	sc.mu.Unlock()
+}
+
+// hidden reports whether any segment of a relative name is a dotfile, which
+// scans never look at (the .ytdl2 sidecar dir, temp files).
+func hidden(name string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(name), "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestScanner(t *testing.T, files ...string) (*Scanner, *atomic.Int32) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := Load(filepath.Join(dir, ".ytdl2", "library.json"))
+	sc := NewScanner(store, dir, func() float64 { return 360 })
+	var calls atomic.Int32
+	sc.probe = func(path string) (Probe, error) {
+		calls.Add(1)
+		if strings.HasSuffix(path, ".mp4") {
+			return Probe{Duration: 60}, nil // video only
+		}
+		if !strings.HasSuffix(path, ".mp3") {
+			return Probe{}, errors.New("not media")
+		}
+		return Probe{Duration: 600, Format: Format{Codec: "mp3"}}, nil
+	}
+	return sc, &calls
+}
+
+func TestScannerProbesOnlyWhatChanged(t *testing.T) {
+	sc, calls := newTestScanner(t, "a.mp3", "Show/b.mp3", "notes.txt", ".hidden.mp3", "clip.mp4")
+
+	<-sc.ScanAll(false)
+	st := sc.Status()
+	if st.Running || st.Seen != 4 || st.Queued != 4 || st.Probed != 3 || st.Failed != 1 {
+		t.Fatalf("first scan status = %+v", st)
+	}
+	if tr, _ := sc.store.Get(filepath.Join("Show", "b.mp3")); tr.Category != CategoryPodcast || tr.Source != SourceGuessed || tr.Fingerprint == "" || tr.Added.IsZero() {
+		t.Fatalf("Show/b.mp3 = %+v", tr)
+	}
+	added, _ := sc.store.Get("a.mp3")
+
+	if tr, _ := sc.store.Get("clip.mp4"); !tr.NoAudio {
+		t.Fatalf("clip.mp4 = %+v, want NoAudio", tr)
+	}
+
+	// Nothing changed: probed files (with or without audio) and known
+	// failures are skipped.
+	<-sc.ScanAll(false)
+	if st := sc.Status(); st.Queued != 0 || calls.Load() != 4 {
+		t.Fatalf("rescan queued %d, %d probes total", st.Queued, calls.Load())
+	}
+
+	// A changed path is probed even though it looks done.
+	<-sc.ScanPaths([]string{"a.mp3", "gone.mp3"})
+	if st := sc.Status(); st.Seen != 1 || st.Probed != 1 || calls.Load() != 5 {
+		t.Fatalf("path scan status = %+v, %d probes total", st, calls.Load())
+	}
+
+	<-sc.ScanAll(true)
+	if st := sc.Status(); st.Queued != 4 {
+		t.Fatalf("forced scan queued %d", st.Queued)
+	}
+	if tr, _ := sc.store.Get("a.mp3"); !tr.Added.Equal(added.Added) {
+		t.Fatalf("rescan moved the added time: %v -> %v", added.Added, tr.Added)
+	}
+}
+
+func TestScannerCoalescesRequests(t *testing.T) {
+	sc, calls := newTestScanner(t, "a.mp3")
+	release := make(chan struct{})
+	probe := sc.probe
+	sc.probe = func(path string) (Probe, error) {
+		<-release
+		return probe(path)
+	}
+
+	first := sc.ScanAll(true)
+	for sc.Status().Queued == 0 {
+		time.Sleep(time.Millisecond) // wait until the first scan is probing
+	}
+	second := sc.ScanAll(true)
+	third := sc.ScanPaths([]string{"a.mp3"})
+	if second != third {
+		t.Fatal("requests made during a scan were not coalesced")
+	}
+	if !sc.Status().Pending {
+		t.Fatal("follow-up scan not reported as pending")
+	}
+	close(release)
+	<-first
+	<-third
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d probes, want 2 (one per scan)", n)
+	}
+}
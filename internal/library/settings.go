@@ -0,0 +1,82 @@
+package library
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Settings are the user-adjustable knobs of the library, changed at runtime
+// through the API and kept in the sidecar dir so they survive restarts.
+type Settings struct {
+	CategoryThreshold float64 `json:"category_threshold"` // seconds; >= this is guessed "podcast"
+	// SpeechDetection makes scans listen to new tracks (see AnalyzeSpeech)
+	// so spoken word is told apart from music by content, not just length.
+	SpeechDetection bool `json:"speech_detection"`
+}
+
+// SettingsStore holds the current Settings and persists every change.
+type SettingsStore struct {
+	mu       sync.RWMutex
+	path     string
+	settings Settings
+}
+
+// LoadSettings reads the settings file at path. Anything the file doesn't set
+// (or a missing or unreadable file) takes its value from defaults, e.g. the
+// environment.
+func LoadSettings(path string, defaults Settings) *SettingsStore {
+	ss := &SettingsStore{path: path, settings: defaults}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("library: read %s: %v — using defaults", path, err)
+		}
+		return ss
+	}
+	var f struct {
+		CategoryThreshold float64 `json:"category_threshold"`
+		SpeechDetection   *bool   `json:"speech_detection"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		log.Printf("library: parse %s: %v — using defaults", path, err)
+		return ss
+	}
+	if f.CategoryThreshold > 0 {
+		ss.settings.CategoryThreshold = f.CategoryThreshold
+	}
+	if f.SpeechDetection != nil {
+		ss.settings.SpeechDetection = *f.SpeechDetection
+	}
+	return ss
+}
+
+// Get returns the current settings.
+func (ss *SettingsStore) Get() Settings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.settings
+}
+
+// Update applies fn to a copy of the settings and, if it returns nil, saves
+// and adopts the result.
+func (ss *SettingsStore) Update(fn func(s *Settings) error) (Settings, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	next := ss.settings
+	if err := fn(&next); err != nil {
+		return ss.settings, err
+	}
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return ss.settings, err
+	}
+	if err := fsutil.WriteFileAtomic(ss.path, data); err != nil {
+		return ss.settings, err
+	}
+	ss.settings = next
+	return next, nil
+}
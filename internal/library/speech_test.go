@@ -0,0 +1,136 @@
+package library
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syntheticMusic is a sustained three-note chord with a steady beat.
+func syntheticMusic(seconds float64) []float64 {
+	out := make([]float64, int(seconds*speechRate))
+	for i := range out {
+		t := float64(i) / speechRate
+		v := 0.2*math.Sin(2*math.Pi*220*t) + 0.15*math.Sin(2*math.Pi*277*t) + 0.15*math.Sin(2*math.Pi*330*t)
+		beat := 0.8 + 0.2*math.Cos(2*math.Pi*2*t) // gentle 120 bpm swell
+		out[i] = v * beat
+	}
+	return out
+}
+
+// syntheticSpeech alternates voiced syllables (a buzzy 120 Hz tone), short
+// noisy consonants and pauses, at about four syllables a second.
+func syntheticSpeech(seconds float64) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	out := make([]float64, int(seconds*speechRate))
+	for i := range out {
+		t := float64(i) / speechRate
+		phase := math.Mod(t*4, 1) // position within the syllable
+		switch {
+		case phase < 0.15: // consonant
+			out[i] = 0.1 * (rng.Float64()*2 - 1)
+		case phase < 0.7: // vowel
+			var v float64
+			for h := 1; h <= 8; h++ {
+				v += math.Sin(2*math.Pi*120*float64(h)*t) / float64(h)
+			}
+			out[i] = 0.3 * v * math.Sin(math.Pi*(phase-0.15)/0.55)
+		default: // gap
+			out[i] = 0.001 * (rng.Float64()*2 - 1)
+		}
+	}
+	return out
+}
+
+func TestSpeechFeaturesSeparateSpeechFromMusic(t *testing.T) {
+	music, ok := speechFeatures(syntheticMusic(speechWindow))
+	if !ok {
+		t.Fatal("music excerpt treated as silent")
+	}
+	speech, ok := speechFeatures(syntheticSpeech(speechWindow))
+	if !ok {
+		t.Fatal("speech excerpt treated as silent")
+	}
+	t.Logf("music %+v score %.2f", music, music.score())
+	t.Logf("speech %+v score %.2f", speech, speech.score())
+
+	if got, _ := (Speech{Score: music.score(), Windows: 1}).Category(); got != CategoryMusic {
+		t.Errorf("music scored %.2f", music.score())
+	}
+	if got, _ := (Speech{Score: speech.score(), Windows: 1}).Category(); got != CategoryPodcast {
+		t.Errorf("speech scored %.2f", speech.score())
+	}
+	if _, ok := speechFeatures(make([]float64, speechRate)); ok {
+		t.Error("silence should not be scored")
+	}
+}
+
+func TestFFT(t *testing.T) {
+	a := make([]complex128, 8)
+	for i := range a {
+		a[i] = complex(math.Cos(2*math.Pi*float64(i)/8), 0)
+	}
+	fft(a)
+	for k, c := range a {
+		want := 0.0
+		if k == 1 || k == 7 {
+			want = 4
+		}
+		if math.Abs(cmplx.Abs(c)-want) > 1e-9 {
+			t.Fatalf("bin %d = %v, want magnitude %v", k, c, want)
+		}
+	}
+}
+
+func TestScannerUsesSpeechAnalysis(t *testing.T) {
+	sc, _ := newTestScanner(t, "long-song.mp3", "Show/ep1.mp3")
+	var enabled bool
+	var analyzed []string
+	sc.Speech = func() bool { return enabled }
+	sc.analyze = func(path string, duration float64) (Speech, error) {
+		analyzed = append(analyzed, filepath.Base(path))
+		if strings.Contains(path, "song") {
+			return Speech{Score: 0.05, Windows: 3}, nil
+		}
+		return Speech{}, errors.New("ffmpeg missing")
+	}
+	sc.Workers = 1
+
+	<-sc.ScanAll(false)
+	if len(analyzed) != 0 {
+		t.Fatalf("analyzed %v with speech detection off", analyzed)
+	}
+
+	enabled = true
+	<-sc.ScanAll(true)
+	if len(analyzed) != 2 {
+		t.Fatalf("analyzed %v, want both files", analyzed)
+	}
+	// A 600 s track is a podcast by duration; the confident analysis wins
+	// once the category is guessed again.
+	song, _ := sc.store.Get("long-song.mp3")
+	if song.Speech.Windows != 3 {
+		t.Fatalf("speech not stored: %+v", song)
+	}
+	if c, _ := sc.Rules.Classify("long-song.mp3", song, 360); c != CategoryMusic {
+		t.Fatalf("Classify = %q, want music", c)
+	}
+	// A failed analysis leaves the duration guess alone.
+	ep, _ := sc.store.Get(filepath.Join("Show", "ep1.mp3"))
+	if ep.Speech.Windows != 0 || ep.Category != CategoryPodcast {
+		t.Fatalf("ep1 = %+v", ep)
+	}
+
+	// New content that can't be analyzed drops the old analysis.
+	os.WriteFile(filepath.Join(sc.dir, "long-song.mp3"), []byte("re-encoded"), 0o644)
+	sc.analyze = func(string, float64) (Speech, error) { return Speech{}, errors.New("ffmpeg missing") }
+	<-sc.ScanAll(false)
+	if song, _ := sc.store.Get("long-song.mp3"); song.Speech != (Speech{}) {
+		t.Fatalf("stale speech kept: %+v", song.Speech)
+	}
+}
@@ -0,0 +1,121 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidTag is returned for tags that are empty, too long or contain a
+// comma or slash (commas separate tags in GET /api/files filters, and tags
+// appear as a path segment in /api/tags/{tag}).
+var ErrInvalidTag = errors.New("invalid tag")
+
+const maxTagLength = 64
+
+// NormalizeTags trims and lowercases tags, checks them, and returns them
+// sorted without duplicates. Tags are case-insensitive, so "Workout" and
+// "workout" are the same tag.
+func NormalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength ||
+			strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || r == '/' || unicode.IsControl(r) }) {
+			return nil, fmt.Errorf("%w: %q must be 1-%d characters without commas or slashes", ErrInvalidTag, tag, maxTagLength)
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// Retag adds and then removes tags on every named track in one batch (tracks
+// without an entry yet get one) and returns each track's resulting tags. add
+// and remove must already be normalized.
+func (s *Store) Retag(names, add, remove []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(names))
+	err := s.Batch(func(tx *Tx) error {
+		for _, name := range names {
+			t, _ := tx.Get(name)
+			tags := slices.Concat(t.Tags, add)
+			slices.Sort(tags)
+			tags = slices.DeleteFunc(slices.Compact(tags), func(tag string) bool {
+				return slices.Contains(remove, tag)
+			})
+			if len(tags) == 0 {
+				tags = nil
+			}
+			result[name] = tags
+			if slices.Equal(tags, t.Tags) {
+				continue
+			}
+			t.Tags = tags
+			tx.Put(name, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TagCount is a tag and how many tracks carry it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagCounts returns every tag in use, most used first (ties by name).
+func (s *Store) TagCounts() []TagCount {
+	s.mu.RLock()
+	counts := make(map[string]int)
+	for _, t := range s.tracks {
+		for _, tag := range t.Tags {
+			counts[tag]++
+		}
+	}
+	s.mu.RUnlock()
+
+	list := make([]TagCount, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, TagCount{Name: name, Count: n})
+	}
+	slices.SortFunc(list, func(a, b TagCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// TagQuery selects tracks by tag. Every part that is set must hold: at least
+// one of Any, all of All, and none of None.
+type TagQuery struct {
+	Any, All, None []string
+}
+
+// Empty reports whether q selects everything.
+func (q TagQuery) Empty() bool {
+	return len(q.Any) == 0 && len(q.All) == 0 && len(q.None) == 0
+}
+
+// Matches reports whether a track with the given (normalized) tags is
+// selected.
+func (q TagQuery) Matches(tags []string) bool {
+	has := func(tag string) bool { return slices.Contains(tags, tag) }
+	if len(q.Any) > 0 && !slices.ContainsFunc(q.Any, has) {
+		return false
+	}
+	for _, tag := range q.All {
+		if !has(tag) {
+			return false
+		}
+	}
+	return !slices.ContainsFunc(q.None, has)
+}
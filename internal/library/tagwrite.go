@@ -0,0 +1,89 @@
+package library
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// MetadataPatch is a partial tag update. Nil fields are left alone; an empty
+// string clears the tag.
+type MetadataPatch struct {
+	Title   *string `json:"title"`
+	Artist  *string `json:"artist"`
+	Album   *string `json:"album"`
+	Track   *string `json:"track"`
+	Genre   *string `json:"genre"`
+	Comment *string `json:"comment"`
+}
+
+// tagField pairs a patch value with its ffmpeg tag key and Metadata field.
+type tagField struct {
+	key   string
+	value *string
+	dst   *string
+}
+
+func (p *MetadataPatch) fields(m *Metadata) []tagField {
+	return []tagField{
+		{"title", p.Title, &m.Title},
+		{"artist", p.Artist, &m.Artist},
+		{"album", p.Album, &m.Album},
+		{"track", p.Track, &m.Track},
+		{"genre", p.Genre, &m.Genre},
+		{"comment", p.Comment, &m.Comment},
+	}
+}
+
+// Empty reports whether the patch changes nothing.
+func (p MetadataPatch) Empty() bool {
+	for _, f := range p.fields(&Metadata{}) {
+		if f.value != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply writes the patch's non-nil fields into m.
+func (p MetadataPatch) Apply(m *Metadata) {
+	for _, f := range p.fields(m) {
+		if f.value != nil {
+			*f.dst = strings.TrimSpace(*f.value)
+		}
+	}
+}
+
+// coverFormats are the containers ffmpeg can store an attached picture in
+// without disturbing real video streams.
+var coverFormats = map[string]bool{".mp3": true, ".m4a": true, ".flac": true}
+
+// CoverSupported reports whether cover art can be written into path.
+func CoverSupported(path string) bool {
+	return coverFormats[strings.ToLower(filepath.Ext(path))]
+}
+
+// WriteTagsArgs returns ffmpeg arguments that copy src to dst without
+// re-encoding while applying p. If coverPath is set, that image replaces any
+// existing attached picture (only valid when CoverSupported(src)).
+func WriteTagsArgs(src, dst string, p MetadataPatch, coverPath string) []string {
+	args := []string{"-hide_banner", "-nostats", "-y", "-i", src}
+	if coverPath != "" {
+		args = append(args, "-i", coverPath,
+			"-map", "0:a", "-map", "1:0",
+			"-disposition:v:0", "attached_pic",
+			"-metadata:s:v:0", "title=Album cover",
+			"-metadata:s:v:0", "comment=Cover (front)")
+	} else {
+		args = append(args, "-map", "0")
+	}
+	args = append(args, "-c", "copy", "-map_metadata", "0")
+	if strings.EqualFold(filepath.Ext(src), ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+	}
+	for _, f := range p.fields(&Metadata{}) {
+		if f.value != nil {
+			args = append(args, "-metadata", f.key+"="+strings.TrimSpace(*f.value))
+		}
+	}
+	return append(args, dst)
+}
@@ -0,0 +1,168 @@
+// Package playlist reads and writes the playlist file formats media players
+// exchange: extended M3U (M3U8 when UTF-8, which is all we write) and XSPF.
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Item is one playlist entry. Location is a URL or a file path.
+type Item struct {
+	Location string
+	Title    string
+	Artist   string
+	Album    string
+	Duration float64 // seconds; 0 if unknown
+}
+
+// DisplayTitle is how M3U shows the item: "Artist - Title", or just the title.
+func (it Item) DisplayTitle() string {
+	if it.Artist != "" && it.Title != "" {
+		return it.Artist + " - " + it.Title
+	}
+	return it.Title
+}
+
+// WriteM3U writes items as an extended M3U playlist with #EXTINF lines.
+func WriteM3U(w io.Writer, title string, items []Item) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#EXTM3U\n")
+	if title != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(title))
+	}
+	for _, it := range items {
+		duration := -1 // unknown, per the de-facto spec
+		if it.Duration > 0 {
+			duration = int(math.Round(it.Duration))
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n%s\n", duration, oneLine(it.DisplayTitle()), oneLine(it.Location))
+	}
+	return bw.Flush()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// xspf mirrors the parts of XSPF 1 (https://xspf.org/spec) we use.
+type xspf struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location []string `xml:"location"`
+	Title    string   `xml:"title,omitempty"`
+	Creator  string   `xml:"creator,omitempty"`
+	Album    string   `xml:"album,omitempty"`
+	Duration int64    `xml:"duration,omitempty"` // milliseconds
+}
+
+// WriteXSPF writes items as an XSPF playlist.
+func WriteXSPF(w io.Writer, title string, items []Item) error {
+	doc := xspf{Version: "1", Title: title, Tracks: make([]xspfTrack, 0, len(items))}
+	for _, it := range items {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location: []string{it.Location},
+			Title:    it.Title,
+			Creator:  it.Artist,
+			Album:    it.Album,
+			Duration: int64(math.Round(it.Duration * 1000)),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ErrUnknownFormat is returned by Parse for data that is neither XSPF nor M3U.
+var ErrUnknownFormat = errors.New("playlist: not an M3U or XSPF file")
+
+// Parse reads an M3U/M3U8 or XSPF playlist, telling them apart by content. It
+// returns the playlist's title, if it has one.
+func Parse(data []byte) (title string, items []Item, err error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		return parseXSPF(data)
+	}
+	return parseM3U(data)
+}
+
+func parseXSPF(data []byte) (string, []Item, error) {
+	var doc xspf
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	var items []Item
+	for _, t := range doc.Tracks {
+		it := Item{Title: t.Title, Artist: t.Creator, Album: t.Album, Duration: float64(t.Duration) / 1000}
+		if len(t.Location) > 0 {
+			it.Location = strings.TrimSpace(t.Location[0])
+		}
+		if it.Location == "" && it.Title == "" {
+			continue
+		}
+		items = append(items, it)
+	}
+	return doc.Title, items, nil
+}
+
+func parseM3U(data []byte) (string, []Item, error) {
+	var title string
+	var items []Item
+	var pending *Item // from the last #EXTINF, waiting for its location
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "#EXTM3U":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			it := Item{}
+			// "#EXTINF:123 key=value ...,Artist - Title"
+			head, display, _ := strings.Cut(info, ",")
+			if fields := strings.Fields(head); len(fields) > 0 {
+				if d, err := strconv.ParseFloat(fields[0], 64); err == nil && d > 0 {
+					it.Duration = d
+				}
+			}
+			it.Title = strings.TrimSpace(display)
+			if artist, t, ok := strings.Cut(it.Title, " - "); ok {
+				it.Artist, it.Title = strings.TrimSpace(artist), strings.TrimSpace(t)
+			}
+			pending = &it
+		case strings.HasPrefix(line, "#"):
+			// Other directives and comments.
+		default:
+			it := Item{}
+			if pending != nil {
+				it = *pending
+				pending = nil
+			}
+			it.Location = line
+			items = append(items, it)
+		}
+	}
+	if items == nil && !strings.HasPrefix(strings.TrimSpace(string(data)), "#EXTM3U") {
+		return "", nil, ErrUnknownFormat
+	}
+	return title, items, nil
+}
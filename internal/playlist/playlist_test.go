@@ -0,0 +1,72 @@
+package playlist
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var items = []Item{
+	{Location: "http://host/api/files/a%20b.mp3", Title: "Song", Artist: "Band", Album: "LP", Duration: 181.6},
+	{Location: "http://host/api/files/talk.m4a", Title: "talk"},
+}
+
+func TestM3URoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteM3U(&buf, "Mix", items); err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:Mix\n" +
+		"#EXTINF:182,Band - Song\nhttp://host/api/files/a%20b.mp3\n" +
+		"#EXTINF:-1,talk\nhttp://host/api/files/talk.m4a\n"
+	if buf.String() != want {
+		t.Fatalf("WriteM3U =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	title, got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Mix" || len(got) != 2 || got[0].Artist != "Band" || got[0].Title != "Song" || got[0].Duration != 182 || got[1].Duration != 0 {
+		t.Fatalf("Parse = %q %+v", title, got)
+	}
+}
+
+func TestParsePlainM3U(t *testing.T) {
+	_, got, err := Parse([]byte("\xef\xbb\xbf# comment\r\nC:\\Music\\a.mp3\r\n\r\nb.mp3\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{{Location: `C:\Music\a.mp3`}, {Location: "b.mp3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Parse = %+v, want %+v", got, want)
+	}
+	// Without #EXTM3U any line is a path, so only input with no lines fails.
+	if _, _, err := Parse([]byte("")); err != ErrUnknownFormat {
+		t.Fatalf("empty input: err = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestXSPFRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteXSPF(&buf, "Mix", items); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`xmlns="http://xspf.org/ns/0/"`, "<duration>181600</duration>", "<creator>Band</creator>"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("WriteXSPF missing %s:\n%s", want, out)
+		}
+	}
+	title, got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Mix" || !reflect.DeepEqual(got, items) {
+		t.Fatalf("Parse = %q %+v, want %+v", title, got, items)
+	}
+	if _, _, err := Parse([]byte("<html>")); err == nil {
+		t.Fatal("Parse(<html>) succeeded")
+	}
+}
@@ -0,0 +1,117 @@
+package podcast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/feed"
+)
+
+// Outline is a feed listed in an OPML file.
+type Outline struct {
+	Title  string
+	XMLURL string
+}
+
+// ErrNotOPML is returned by ParseOPML for documents that aren't OPML.
+var ErrNotOPML = errors.New("podcast: not an OPML file")
+
+type opmlOutline struct {
+	Attrs    []xml.Attr    `xml:",any,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+func (o opmlOutline) attr(name string) string {
+	for _, a := range o.Attrs {
+		// Exporters disagree on the case (xmlUrl, xmlurl, XMLURL).
+		if strings.EqualFold(a.Name.Local, name) {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+// ParseOPML returns every outline with an xmlUrl, however deeply nested in
+// folders, in document order.
+func ParseOPML(data []byte) ([]Outline, error) {
+	var doc struct {
+		XMLName xml.Name
+		Body    struct {
+			Outlines []opmlOutline `xml:"outline"`
+		} `xml:"body"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = feed.CharsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotOPML, err)
+	}
+	if doc.XMLName.Local != "opml" {
+		return nil, ErrNotOPML
+	}
+	var out []Outline
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			if u := o.attr("xmlUrl"); u != "" {
+				out = append(out, Outline{Title: firstOf(o.attr("text"), o.attr("title")), XMLURL: u})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Body.Outlines)
+	return out, nil
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type opmlOut struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Outlines []opmlFeed `xml:"body>outline"`
+}
+
+type opmlFeed struct {
+	Type   string `xml:"type,attr"`
+	Text   string `xml:"text,attr"`
+	Title  string `xml:"title,attr"`
+	XMLURL string `xml:"xmlUrl,attr"`
+}
+
+// WriteOPML writes subs as an OPML 2.0 subscription list, which any podcast
+// app can import.
+func WriteOPML(w io.Writer, title string, subs []Subscription) error {
+	doc := opmlOut{Version: "2.0", Outlines: make([]opmlFeed, 0, len(subs))}
+	doc.Head.Title = title
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	for _, sub := range subs {
+		name := firstOf(sub.Title, sub.URL)
+		doc.Outlines = append(doc.Outlines, opmlFeed{Type: "rss", Text: name, Title: name, XMLURL: sub.URL})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
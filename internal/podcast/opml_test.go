@@ -0,0 +1,58 @@
+package podcast
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOPMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	subs := []Subscription{
+		{Title: "Deep Dive", URL: "https://example.com/deep.xml"},
+		{URL: "https://example.com/a?x=1&y=2"},
+	}
+	if err := WriteOPML(&buf, "ytdl2 subscriptions", subs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseOPML(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Outline{
+		{Title: "Deep Dive", XMLURL: "https://example.com/deep.xml"},
+		{Title: "https://example.com/a?x=1&y=2", XMLURL: "https://example.com/a?x=1&y=2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip = %+v\n%s", got, buf.String())
+	}
+}
+
+func TestParseOPMLFolders(t *testing.T) {
+	got, err := ParseOPML([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="1.0"><head><title>Old app</title></head><body>
+  <outline text="News">
+    <outline type="rss" text="Caf` + "\xe9 \x93Live\x94" + `" xmlUrl="https://example.com/cafe.rss"/>
+    <outline type="rss" text="Daily" xmlurl="https://example.com/daily.rss"/>
+    <outline text="No feed here" htmlUrl="https://example.com/"/>
+  </outline>
+  <outline type="rss" title="Weekly" xmlUrl=" https://example.com/weekly.rss "/>
+</body></opml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Outline{
+		{Title: "Café “Live”", XMLURL: "https://example.com/cafe.rss"}, // Latin-1, read as Windows-1252
+		{Title: "Daily", XMLURL: "https://example.com/daily.rss"},
+		{Title: "Weekly", XMLURL: "https://example.com/weekly.rss"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseOPML = %+v", got)
+	}
+	if _, err := ParseOPML([]byte(`<rss version="2.0"></rss>`)); err == nil {
+		t.Fatal("ParseOPML(rss) succeeded")
+	}
+	if _, err := ParseOPML([]byte(`<?xml version="1.0" encoding="Shift_JIS"?><opml><body/></opml>`)); err == nil {
+		t.Fatal("ParseOPML(Shift_JIS) succeeded")
+	}
+}
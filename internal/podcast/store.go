@@ -0,0 +1,267 @@
+// Package podcast keeps podcast subscriptions: feeds checked on a schedule
+// whose new episodes are downloaded into a folder per show.
+package podcast
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Subscription is a feed whose episodes are downloaded.
+type Subscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Folder      string    `json:"folder"`      // relative to the download directory
+	KeepLatest  int       `json:"keep_latest"` // newest episodes kept on disk; 0 keeps all
+	CreatedAt   time.Time `json:"created_at"`
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	Episodes    []Episode `json:"episodes"` // every episode downloaded, newest first
+}
+
+// Episode records a downloaded episode, so it is downloaded only once even
+// after its file was removed.
+type Episode struct {
+	GUID      string    `json:"guid"`
+	Title     string    `json:"title"`
+	Published time.Time `json:"published,omitzero"`
+	File      string    `json:"file,omitempty"` // library file; "" once removed
+}
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrSubscriptionExists   = errors.New("already subscribed to this feed")
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+)
+
+// DefaultKeepLatest is how many episodes a new subscription keeps unless
+// told otherwise.
+const DefaultKeepLatest = 5
+
+const maxTitle = 200
+
+func (sub *Subscription) validate() error {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidSubscription)
+	}
+	sub.Title = strings.TrimSpace(sub.Title)
+	if len(sub.Title) > maxTitle {
+		return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidSubscription, maxTitle)
+	}
+	folder := filepath.Clean(sub.Folder)
+	if sub.Folder == "" || filepath.IsAbs(folder) || folder == "." || folder == ".." ||
+		strings.HasPrefix(folder, ".."+string(filepath.Separator)) || hidden(folder) {
+		return fmt.Errorf("%w: folder must be a visible folder inside the download directory", ErrInvalidSubscription)
+	}
+	sub.Folder = folder
+	if sub.KeepLatest < 0 {
+		return fmt.Errorf("%w: keep_latest must not be negative", ErrInvalidSubscription)
+	}
+	return nil
+}
+
+func hidden(name string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(name), "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is the set of subscriptions, kept in .ytdl2/subscriptions.json.
+type Store struct {
+	mu   sync.Mutex
+	file *fsutil.JSONFile
+	subs []Subscription // in creation order
+}
+
+type subscriptionsFile struct {
+	Version       int            `json:"version"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// Load reads the subscription file at path (missing means none; an
+// unparseable one is set aside).
+func Load(path string) *Store {
+	st := &Store{file: fsutil.NewJSONFile(path)}
+	var f subscriptionsFile
+	if err := st.file.Load(&f); err != nil {
+		log.Printf("podcast: %v — starting without subscriptions", err)
+	}
+	st.subs = f.Subscriptions
+	return st
+}
+
+// List returns every subscription, oldest first.
+func (st *Store) List() []Subscription {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return cloneSubscriptions(st.subs)
+}
+
+// Get returns one subscription.
+func (st *Store) Get(id string) (Subscription, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	i := st.index(id)
+	if i < 0 {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return cloneSubscription(st.subs[i]), nil
+}
+
+// Find returns the subscription to the feed at url, if there is one.
+func (st *Store) Find(url string) (Subscription, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, sub := range st.subs {
+		if SameFeed(sub.URL, url) {
+			return cloneSubscription(sub), true
+		}
+	}
+	return Subscription{}, false
+}
+
+// Create saves a new subscription and returns it with its ID. A feed can be
+// subscribed to only once.
+func (st *Store) Create(sub Subscription) (Subscription, error) {
+	sub.ID = fsutil.NewID("s")
+	sub.CreatedAt = time.Now().UTC()
+	sub.LastChecked, sub.LastError = time.Time{}, ""
+	sub.Episodes = []Episode{}
+	if err := sub.validate(); err != nil {
+		return sub, err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if slices.ContainsFunc(st.subs, func(s Subscription) bool { return SameFeed(s.URL, sub.URL) }) {
+		return sub, ErrSubscriptionExists
+	}
+	return sub, st.commit(append(cloneSubscriptions(st.subs), sub))
+}
+
+// Update applies fn to a copy of the subscription and saves the result. If
+// fn fails nothing changes. The ID, URL and creation time can't be changed.
+func (st *Store) Update(id string, fn func(sub *Subscription) error) (Subscription, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	i := st.index(id)
+	if i < 0 {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	sub := cloneSubscription(st.subs[i])
+	if err := fn(&sub); err != nil {
+		return sub, err
+	}
+	sub.ID, sub.URL, sub.CreatedAt = id, st.subs[i].URL, st.subs[i].CreatedAt
+	if err := sub.validate(); err != nil {
+		return sub, err
+	}
+	subs := cloneSubscriptions(st.subs)
+	subs[i] = sub
+	return sub, st.commit(subs)
+}
+
+// Delete removes a subscription. Downloaded files are kept.
+func (st *Store) Delete(id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	i := st.index(id)
+	if i < 0 {
+		return ErrSubscriptionNotFound
+	}
+	return st.commit(slices.Delete(cloneSubscriptions(st.subs), i, i+1))
+}
+
+// RenameFile follows a downloaded episode's file after it moved.
+func (st *Store) RenameFile(oldName, newName string) error {
+	return st.rewrite(func(e *Episode) {
+		if e.File == oldName {
+			e.File = newName
+		}
+	})
+}
+
+// RemoveFile forgets a downloaded episode's file after it was deleted. The
+// episode stays recorded, so it isn't downloaded again.
+func (st *Store) RemoveFile(name string) error {
+	return st.rewrite(func(e *Episode) {
+		if e.File == name {
+			e.File = ""
+		}
+	})
+}
+
+// rewrite passes every episode of every subscription through fn and saves
+// if anything changed.
+func (st *Store) rewrite(fn func(e *Episode)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	subs := cloneSubscriptions(st.subs)
+	changed := false
+	for i := range subs {
+		for j := range subs[i].Episodes {
+			before := subs[i].Episodes[j]
+			fn(&subs[i].Episodes[j])
+			if subs[i].Episodes[j] != before {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return st.commit(subs)
+}
+
+func (st *Store) index(id string) int {
+	return slices.IndexFunc(st.subs, func(s Subscription) bool { return s.ID == id })
+}
+
+// commit saves subs and, once saved, makes them current.
+func (st *Store) commit(subs []Subscription) error {
+	if err := st.file.Save(subscriptionsFile{Version: 1, Subscriptions: subs}); err != nil {
+		return err
+	}
+	st.subs = subs
+	return nil
+}
+
+// SameFeed reports whether two feed URLs are the same feed, ignoring the
+// scheme, the host's case and a trailing slash, which feeds are often listed
+// with either way.
+func SameFeed(a, b string) bool {
+	norm := func(s string) string {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return s
+		}
+		return strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/") + "?" + u.RawQuery
+	}
+	return norm(a) == norm(b)
+}
+
+func cloneSubscription(sub Subscription) Subscription {
+	sub.Episodes = slices.Clone(sub.Episodes)
+	return sub
+}
+
+func cloneSubscriptions(subs []Subscription) []Subscription {
+	out := make([]Subscription, len(subs))
+	for i, sub := range subs {
+		out[i] = cloneSubscription(sub)
+	}
+	return out
+}
@@ -0,0 +1,489 @@
+package podcast
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iwanhae/ytdl2/internal/feed"
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+const (
+	// maxFeedSize bounds a fetched feed; long-running shows' feeds with full
+	// show notes run to a few megabytes.
+	maxFeedSize = 20 << 20
+	// fetchTimeout bounds fetching a feed (not downloading episodes).
+	fetchTimeout = time.Minute
+	// checkEvery is how often Run looks for subscriptions that are due.
+	checkEvery = time.Minute
+)
+
+var (
+	// episodeIdleTimeout gives up on an episode download that got no
+	// response, or no data, for this long. Downloads have no overall limit,
+	// as long episodes on slow links can take a while.
+	episodeIdleTimeout = 2 * time.Minute
+	// maxEpisodeSize bounds one episode file; long video episodes run to a
+	// few gigabytes.
+	maxEpisodeSize int64 = 8 << 30
+)
+
+// errStalled is why a download that stopped receiving data was cancelled.
+var errStalled = errors.New("download stalled")
+
+// Syncer downloads new episodes of subscriptions and enforces their
+// keep-latest limits. Syncs run one at a time.
+type Syncer struct {
+	store   *Store
+	library *library.Store
+	dir     string // the download directory
+
+	// Client fetches feeds and episodes; http.DefaultClient if nil.
+	Client *http.Client
+	// Remove deletes a downloaded file (relative to the download directory)
+	// past a subscription's keep-latest limit, along with anything derived
+	// from it. By default only the file and its library entry go.
+	Remove func(name string) error
+	// Downloaded, if set, is called with each new file, e.g. to probe it.
+	Downloaded func(name string)
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// NewSyncer returns a Syncer downloading into dir for store's subscriptions,
+// recording episodes in lib.
+func NewSyncer(store *Store, lib *library.Store, dir string) *Syncer {
+	return &Syncer{store: store, library: lib, dir: dir, wake: make(chan struct{}, 1)}
+}
+
+// Result is what one sync did.
+type Result struct {
+	Downloaded []string `json:"downloaded"` // new files
+	Removed    []string `json:"removed"`    // files past the keep-latest limit
+	Failed     []string `json:"failed"`     // episodes that couldn't be downloaded, with why
+}
+
+func (sy *Syncer) client() *http.Client {
+	if sy.Client != nil {
+		return sy.Client
+	}
+	return http.DefaultClient
+}
+
+func (sy *Syncer) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ytdl2")
+	resp, err := sy.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// Fetch fetches and parses the feed at url.
+func (sy *Syncer) Fetch(ctx context.Context, url string) (feed.Channel, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	resp, err := sy.get(ctx, url)
+	if err != nil {
+		return feed.Channel{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return feed.Channel{}, err
+	}
+	if len(data) > maxFeedSize {
+		return feed.Channel{}, fmt.Errorf("feed is larger than %d MiB", maxFeedSize>>20)
+	}
+	return feed.Parse(data)
+}
+
+// ErrSyncInProgress is returned by TrySync while another sync is running.
+var ErrSyncInProgress = errors.New("a sync is already running; try again when it finishes")
+
+// Sync fetches the subscription's feed, downloads the episodes within its
+// keep-latest limit that weren't downloaded before, and removes downloaded
+// files past the limit. An episode that fails to download is retried on
+// the next sync; the error is returned only if the feed itself failed. Syncs
+// run one at a time; Sync waits for a running one to finish.
+func (sy *Syncer) Sync(ctx context.Context, id string) (Result, error) {
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	return sy.sync(ctx, id)
+}
+
+// TrySync is Sync without the wait: if a sync is already running it returns
+// ErrSyncInProgress at once, so a request doesn't hang behind a long
+// background run.
+func (sy *Syncer) TrySync(ctx context.Context, id string) (Result, error) {
+	if !sy.mu.TryLock() {
+		return Result{}, ErrSyncInProgress
+	}
+	defer sy.mu.Unlock()
+	return sy.sync(ctx, id)
+}
+
+// sync is Sync for a caller holding sy.mu.
+func (sy *Syncer) sync(ctx context.Context, id string) (Result, error) {
+	res := Result{Downloaded: []string{}, Removed: []string{}, Failed: []string{}}
+	sub, err := sy.store.Get(id)
+	if err != nil {
+		return res, err
+	}
+
+	ch, err := sy.Fetch(ctx, sub.URL)
+	if err != nil {
+		sy.store.Update(id, func(s *Subscription) error {
+			s.LastChecked = time.Now().UTC()
+			s.LastError = err.Error()
+			return nil
+		})
+		return res, err
+	}
+	if sub.Title == "" {
+		sub.Title = ch.Title
+	}
+
+	var items []feed.Item
+	for _, it := range ch.Items {
+		if it.Enclosure.URL != "" && it.GUID != "" {
+			items = append(items, it)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b feed.Item) int { return b.Published.Compare(a.Published) })
+	if sub.KeepLatest > 0 && len(items) > sub.KeepLatest {
+		items = items[:sub.KeepLatest]
+	}
+	known := make(map[string]bool, len(sub.Episodes))
+	for _, e := range sub.Episodes {
+		known[e.GUID] = true
+	}
+
+	for _, it := range items {
+		if known[it.GUID] {
+			continue
+		}
+		name, err := sy.download(ctx, sub, it)
+		if err != nil {
+			res.Failed = append(res.Failed, fmt.Sprintf("%s: %v", it.Title, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		// Record each episode as soon as its file is in place, so it is never
+		// downloaded twice, even if the process stops mid-sync.
+		ep := Episode{GUID: it.GUID, Title: it.Title, Published: it.Published, File: name}
+		_, err = sy.store.Update(id, func(s *Subscription) error {
+			s.Episodes = append([]Episode{ep}, s.Episodes...)
+			slices.SortStableFunc(s.Episodes, func(a, b Episode) int { return b.Published.Compare(a.Published) })
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Downloaded = append(res.Downloaded, name)
+		if sy.Downloaded != nil {
+			sy.Downloaded(name)
+		}
+	}
+
+	sub, err = sy.store.Update(id, func(s *Subscription) error {
+		if s.Title == "" {
+			s.Title = ch.Title
+		}
+		s.LastChecked = time.Now().UTC()
+		s.LastError = strings.Join(res.Failed, "; ")
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	if sub.KeepLatest > 0 {
+		kept := 0
+		for _, e := range sub.Episodes {
+			if e.File == "" {
+				continue
+			}
+			if kept++; kept <= sub.KeepLatest {
+				continue
+			}
+			if err := sy.remove(e.File); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("podcast: remove %s: %v", e.File, err)
+				continue
+			}
+			if err := sy.store.RemoveFile(e.File); err != nil {
+				log.Printf("podcast: forget %s: %v", e.File, err)
+			}
+			res.Removed = append(res.Removed, e.File)
+		}
+	}
+	return res, nil
+}
+
+func (sy *Syncer) remove(name string) error {
+	if sy.Remove != nil {
+		return sy.Remove(name)
+	}
+	if err := os.Remove(filepath.Join(sy.dir, name)); err != nil {
+		return err
+	}
+	return sy.library.Delete(name)
+}
+
+// download saves an episode into the subscription's folder and records it
+// in the library as a podcast, returning its name relative to the download
+// directory.
+func (sy *Syncer) download(ctx context.Context, sub Subscription, it feed.Item) (string, error) {
+	dir := filepath.Join(sy.dir, sub.Folder)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// The download is cancelled once the server stops sending for a while,
+	// so one stalled server can't hold up every other subscription.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stall := time.AfterFunc(episodeIdleTimeout, func() { cancel(errStalled) })
+	defer stall.Stop()
+	stalled := func(err error) error {
+		if errors.Is(context.Cause(ctx), errStalled) {
+			return fmt.Errorf("%w: nothing received for %v", errStalled, episodeIdleTimeout)
+		}
+		return err
+	}
+
+	resp, err := sy.get(ctx, it.Enclosure.URL)
+	if err != nil {
+		return "", stalled(err)
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > maxEpisodeSize {
+		return "", fmt.Errorf("episode is larger than %d MiB", maxEpisodeSize>>20)
+	}
+
+	base := uniqueName(dir, episodeFileName(it, resp.Header.Get("Content-Type")))
+	// Hidden while incomplete, so listings and the watcher ignore it.
+	part := filepath.Join(dir, "."+base+".part")
+	f, err := os.Create(part)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(part) // after a failure; a no-op once renamed
+	body := &idleReader{r: resp.Body, timer: stall, timeout: episodeIdleTimeout}
+	n, err := io.Copy(f, io.LimitReader(body, maxEpisodeSize+1))
+	if err == nil && n > maxEpisodeSize {
+		err = fmt.Errorf("episode is larger than %d MiB", maxEpisodeSize>>20)
+	}
+	if err != nil {
+		f.Close()
+		return "", stalled(err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(part, filepath.Join(dir, base)); err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(sub.Folder, base)
+	err = sy.library.Update(name, func(t *library.Track) {
+		t.Category = library.CategoryPodcast
+		t.Source = library.SourceManual
+		t.Episode = &library.Episode{
+			Show:      sub.Title,
+			Title:     it.Title,
+			Published: it.Published,
+			Notes:     it.Description,
+			Link:      it.Link,
+			GUID:      it.GUID,
+		}
+	})
+	if err != nil {
+		log.Printf("podcast: record %s: %v", name, err)
+	}
+	return name, nil
+}
+
+// idleReader restarts timer whenever a read returns data.
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// episodeTypes maps enclosure types to extensions, for enclosure URLs
+// without a usable one.
+var episodeTypes = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".aac",
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".opus",
+	"audio/flac":  ".flac",
+	"video/mp4":   ".mp4",
+}
+
+// episodeFileName names an episode's file "2024-03-05 Title.mp3", so a show's
+// folder sorts by date. The extension comes from the enclosure URL, else
+// from its type.
+func episodeFileName(it feed.Item, contentType string) string {
+	ext := strings.ToLower(path.Ext(urlPath(it.Enclosure.URL)))
+	if len(ext) < 2 || len(ext) > 5 || strings.IndexFunc(ext[1:], func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) >= 0 {
+		ext = ""
+		for _, t := range []string{it.Enclosure.Type, contentType} {
+			t, _, _ = mime.ParseMediaType(t)
+			if e, ok := episodeTypes[t]; ok {
+				ext = e
+				break
+			}
+			if exts, _ := mime.ExtensionsByType(t); len(exts) > 0 {
+				ext = exts[0]
+				break
+			}
+		}
+	}
+	title := sanitize(it.Title)
+	if title == "" {
+		title = sanitize(strings.TrimSuffix(path.Base(urlPath(it.Enclosure.URL)), path.Ext(urlPath(it.Enclosure.URL))))
+	}
+	if title == "" {
+		title = "episode"
+	}
+	if !it.Published.IsZero() {
+		title = it.Published.Format("2006-01-02") + " " + title
+	}
+	return title + ext
+}
+
+func urlPath(raw string) string {
+	raw, _, _ = strings.Cut(raw, "?")
+	raw, _, _ = strings.Cut(raw, "#")
+	return raw
+}
+
+// DefaultFolder is where a show's episodes go unless told otherwise.
+func DefaultFolder(title string) string {
+	if title = sanitize(title); title == "" {
+		title = "Untitled"
+	}
+	return filepath.Join("Podcasts", title)
+}
+
+// maxNameLength keeps file names well under common 255-byte limits.
+const maxNameLength = 150
+
+// sanitize makes s safe as a file name on any platform.
+func sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), strings.ContainsRune(`/\:*?"<>|`, r):
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimLeft(s, ". ") // no hidden files
+	for len(s) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return strings.TrimRight(s, ". ")
+}
+
+// uniqueName returns base, or "stem (2).ext" and so on if base is taken in
+// dir.
+func uniqueName(dir, base string) string {
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := base
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, name)); errors.Is(err, fs.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+	}
+}
+
+// Wake makes Run check for due subscriptions now, e.g. after one was added.
+func (sy *Syncer) Wake() {
+	select {
+	case sy.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SyncDue syncs every subscription not checked within interval.
+func (sy *Syncer) SyncDue(ctx context.Context, interval time.Duration) {
+	subs := sy.store.List()
+	slices.SortFunc(subs, func(a, b Subscription) int { return cmp.Compare(a.LastChecked.Unix(), b.LastChecked.Unix()) })
+	for _, sub := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(sub.LastChecked) < interval {
+			continue
+		}
+		res, err := sy.Sync(ctx, sub.ID)
+		switch {
+		case errors.Is(err, ErrSubscriptionNotFound):
+		case err != nil:
+			log.Printf("podcast: %s: %v", sub.URL, err)
+		case len(res.Downloaded)+len(res.Removed)+len(res.Failed) > 0:
+			log.Printf("podcast: %s: %d downloaded, %d removed, %d failed", sub.Title, len(res.Downloaded), len(res.Removed), len(res.Failed))
+		}
+	}
+}
+
+// Run syncs each subscription every interval (and new ones as soon as Wake
+// is called) until ctx is done.
+func (sy *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(min(checkEvery, interval))
+	defer ticker.Stop()
+	for {
+		sy.SyncDue(ctx, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-sy.wake:
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package podcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/feed"
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// feedServer serves an RSS feed of episodes (newest last) and their
+// enclosures, counting enclosure downloads.
+type feedServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	episodes  []string
+	downloads map[string]int
+}
+
+func newFeedServer(t *testing.T, episodes ...string) *feedServer {
+	fs := &feedServer{episodes: episodes, downloads: make(map[string]int)}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if r.URL.Path == "/feed.xml" {
+			fmt.Fprint(w, `<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>The Show</title>`)
+			for i, ep := range fs.episodes {
+				published := time.Date(2024, 3, 1+i, 9, 0, 0, 0, time.UTC).Format(time.RFC1123Z)
+				fmt.Fprintf(w, `<item><title>%s</title><guid>%s</guid><pubDate>%s</pubDate><description>Notes for %s</description>`+
+					`<enclosure url="%s/media/%s.mp3?token=x" length="5" type="audio/mpeg"/></item>`, ep, ep, published, ep, fs.URL, ep)
+			}
+			fmt.Fprint(w, `</channel></rss>`)
+			return
+		}
+		ep := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/media/"), ".mp3")
+		switch ep {
+		case "broken":
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		case "stalled":
+			fmt.Fprint(w, "aud")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		fs.downloads[ep]++
+		fmt.Fprint(w, "audio "+ep)
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *feedServer) publish(ep string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.episodes = append(fs.episodes, ep)
+}
+
+func newTestSyncer(t *testing.T) (*Syncer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	lib, err := library.Open("json", filepath.Join(dir, ".ytdl2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSyncer(Load(filepath.Join(dir, ".ytdl2", "subscriptions.json")), lib, dir), dir
+}
+
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestSyncDownloadsLatestEpisodes(t *testing.T) {
+	fs := newFeedServer(t, "one", "two", "three")
+	sy, dir := newTestSyncer(t)
+	sub, err := sy.store.Create(Subscription{URL: fs.URL + "/feed.xml", Folder: "Podcasts/The Show", KeepLatest: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sy.store.Create(Subscription{URL: strings.Replace(fs.URL, "http:", "https:", 1) + "/feed.xml/", Folder: "x"}); err != ErrSubscriptionExists {
+		t.Fatalf("duplicate feed: err = %v", err)
+	}
+
+	res, err := sy.Sync(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	show := filepath.Join(dir, "Podcasts", "The Show")
+	want := []string{"2024-03-02 two.mp3", "2024-03-03 three.mp3"}
+	if got := files(t, show); !slices.Equal(got, want) || len(res.Downloaded) != 2 {
+		t.Fatalf("files = %v (result %+v), want %v", got, res, want)
+	}
+	tr, _ := sy.library.Get(filepath.Join("Podcasts", "The Show", "2024-03-03 three.mp3"))
+	if tr.Category != library.CategoryPodcast || tr.Source != library.SourceManual || tr.Episode == nil ||
+		tr.Episode.Show != "The Show" || tr.Episode.Title != "three" || tr.Episode.Notes != "Notes for three" ||
+		!tr.Episode.Published.Equal(time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("track = %+v (episode %+v)", tr, tr.Episode)
+	}
+
+	// A new episode pushes the oldest kept one out; nothing is fetched twice.
+	fs.publish("four")
+	fs.publish("broken")
+	res, err = sy.Sync(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"2024-03-03 three.mp3", "2024-03-04 four.mp3"}
+	if got := files(t, show); !slices.Equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if len(res.Removed) != 1 || len(res.Failed) != 1 || fs.downloads["three"] != 1 {
+		t.Fatalf("result = %+v, downloads %v", res, fs.downloads)
+	}
+	if _, ok := sy.library.Get(filepath.Join("Podcasts", "The Show", "2024-03-02 two.mp3")); ok {
+		t.Fatal("removed episode is still in the library")
+	}
+	sub, _ = sy.store.Get(sub.ID)
+	if sub.Title != "The Show" || len(sub.Episodes) != 3 || sub.Episodes[2].File != "" || !strings.Contains(sub.LastError, "broken") {
+		t.Fatalf("subscription = %+v", sub)
+	}
+}
+
+func TestSyncRecordsEachEpisodeAndGivesUpOnStalls(t *testing.T) {
+	defer func(d time.Duration) { episodeIdleTimeout = d }(episodeIdleTimeout)
+	episodeIdleTimeout = 100 * time.Millisecond
+
+	fs := newFeedServer(t, "one", "stalled", "three")
+	sy, dir := newTestSyncer(t)
+	sub, _ := sy.store.Create(Subscription{URL: fs.URL + "/feed.xml", Folder: "Show"})
+	// By the time a file is reported, its episode is saved, so a restart
+	// right after won't download it again.
+	var unrecorded []string
+	sy.Downloaded = func(name string) {
+		if got, _ := Load(sy.store.file.Path()).Get(sub.ID); !slices.ContainsFunc(got.Episodes, func(e Episode) bool { return e.File == name }) {
+			unrecorded = append(unrecorded, name)
+		}
+	}
+
+	res, err := sy.Sync(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Downloaded) != 2 || len(res.Failed) != 1 || !strings.Contains(res.Failed[0], "nothing received") || len(unrecorded) > 0 {
+		t.Fatalf("result = %+v, unrecorded %v", res, unrecorded)
+	}
+	if got := files(t, filepath.Join(dir, "Show")); len(got) != 2 {
+		t.Fatalf("files = %v (partial download left behind?)", got)
+	}
+}
+
+func TestSyncRecordsFeedErrors(t *testing.T) {
+	fs := newFeedServer(t)
+	sy, _ := newTestSyncer(t)
+	sub, _ := sy.store.Create(Subscription{URL: fs.URL + "/missing.xml", Folder: "Show"})
+	if _, err := sy.Sync(context.Background(), sub.ID); err == nil {
+		t.Fatal("sync of a bad feed succeeded")
+	}
+	sub, _ = sy.store.Get(sub.ID)
+	if sub.LastError == "" || sub.LastChecked.IsZero() {
+		t.Fatalf("subscription = %+v", sub)
+	}
+}
+
+func TestTrySyncDoesNotWait(t *testing.T) {
+	sy, _ := newTestSyncer(t)
+	sy.mu.Lock() // a sync is running
+	_, err := sy.TrySync(context.Background(), "s-missing")
+	sy.mu.Unlock()
+	if !errors.Is(err, ErrSyncInProgress) {
+		t.Fatalf("TrySync during a sync = %v, want ErrSyncInProgress", err)
+	}
+	if _, err := sy.TrySync(context.Background(), "s-missing"); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("TrySync when idle = %v", err)
+	}
+}
+
+func TestEpisodeFileName(t *testing.T) {
+	for _, tc := range []struct {
+		title, url, typ, want string
+	}{
+		{"Ep 1: A/B?", "http://x/a.mp3", "", "Ep 1 A B.mp3"},
+		{"", "http://x/track-9.m4a?x=1", "", "track-9.m4a"},
+		{"..hidden", "http://x/download", "audio/mpeg", "hidden.mp3"},
+	} {
+		it := feed.Item{Title: tc.title, Enclosure: feed.Enclosure{URL: tc.url, Type: tc.typ}}
+		if got := episodeFileName(it, ""); got != tc.want {
+			t.Errorf("episodeFileName(%q, %q) = %q, want %q", tc.title, tc.url, got, tc.want)
+		}
+	}
+}
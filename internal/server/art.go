@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/art"
+)
+
+// GET /api/files/{filename}/art?size=small|medium|large
+// Serves the file's cover art as JPEG (medium by default), extracting it on
+// first use. 404 if the file has no artwork. The art_url in GET /api/files
+// carries a version parameter, so responses to it are cached indefinitely.
+func (s *Server) handleArt(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	filePath, err := s.safePath(filename)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid filename",
+		})
+		return
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "File not found",
+		})
+		return
+	}
+
+	size := art.SizeMedium
+	if v := r.URL.Query().Get("size"); v != "" {
+		size = art.Size(v)
+		if _, ok := art.Sizes[size]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "size must be \"small\", \"medium\" or \"large\"",
+			})
+			return
+		}
+	}
+
+	if err := s.artwork.Ensure(filename, filePath); err != nil {
+		if errors.Is(err, art.ErrNoArt) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "No artwork",
+			})
+			return
+		}
+		log.Printf("Failed to extract artwork for %s: %v", filename, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to extract artwork: %v", err),
+		})
+		return
+	}
+
+	f, err := os.Open(s.artwork.Path(filename, size))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to open artwork: %v", err),
+		})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to open artwork: %v", err),
+		})
+		return
+	}
+
+	if r.URL.Query().Has("v") {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// artURL returns the versioned artwork URL for name if current artwork has
+// already been extracted, or "" otherwise. Listing never extracts.
+func (s *Server) artURL(name string, modTime time.Time) string {
+	generated, ok := s.artwork.Lookup(name, modTime)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s/art?v=%d", fileURL(name), generated.Unix())
+}
+
+// extractMissingArt walks the download directory and extracts artwork for
+// every file that doesn't have it yet. Files without a picture are remembered
+// by the art store, so repeated runs only touch new or changed files.
+func (s *Server) extractMissingArt() {
+	_ = filepath.WalkDir(s.DownloadDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return nil // tolerate unreadable entries
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.DownloadDirectory, path)
+		if err != nil {
+			return nil
+		}
+		s.ensureArt(rel, path)
+		return nil
+	})
+}
+
+// ensureArt extracts artwork for one file if it's missing or stale, logging
+// failures other than the file simply having no picture.
+func (s *Server) ensureArt(name, path string) {
+	if err := s.artwork.Ensure(name, path); err != nil && !errors.Is(err, art.ErrNoArt) {
+		log.Printf("Failed to extract artwork for %s: %v", name, err)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/art"
+)
+
+func TestArtServedAndListed(t *testing.T) {
+	s, _ := newTestServer(t)
+	for size := range art.Sizes {
+		p := s.artwork.Path("song.mp3", size)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte("jpeg-"+string(size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := do(t, s, http.MethodGet, "/api/files", "")
+	var lr struct {
+		Files []struct {
+			ArtURL string `json:"art_url"`
+		} `json:"files"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &lr)
+	if len(lr.Files) != 1 || !strings.HasPrefix(lr.Files[0].ArtURL, "/api/files/song.mp3/art?v=") {
+		t.Fatalf("art_url = %+v", lr.Files)
+	}
+
+	rec = do(t, s, http.MethodGet, lr.Files[0].ArtURL+"&size=small", "")
+	if rec.Code != 200 || rec.Body.String() != "jpeg-small" {
+		t.Fatalf("art status = %d body=%q", rec.Code, rec.Body.String())
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Fatalf("Cache-Control = %q", cc)
+	}
+}
+
+func TestArtMissing(t *testing.T) {
+	s, _ := newTestServer(t)
+	// "fake audio" has no picture stream (and ffmpeg may be absent): 404, not 500.
+	if rec := do(t, s, http.MethodGet, "/api/files/song.mp3/art", ""); rec.Code != 404 {
+		t.Fatalf("missing art status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files/song.mp3/art?size=huge", ""); rec.Code != 400 {
+		t.Fatalf("bad size status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// categoryInfo is a category as listed by the API.
+type categoryInfo struct {
+	library.CategoryDef
+	Builtin bool `json:"builtin"`
+	Tracks  int  `json:"tracks"` // files currently filed under it
+}
+
+// GET /api/categories
+// Response: {"categories": [{"name": string, "label": string, "color"?: string,
+// "rule"?: {"min_seconds"?: float64, "max_seconds"?: float64}, "builtin": bool, "tracks": int}]}
+//
+// POST /api/categories
+// Body: {"name": string, "label"?: string, "color"?: "#rrggbb", "rule"?: {...}}
+// Response: 201 with the category
+// Categories with a rule are guessed for new tracks whose duration falls in
+// its range; the rest are only assigned by hand. Music and podcast are built in.
+func (s *Server) handleCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		counts := make(map[library.Category]int)
+		for _, t := range s.library.All() {
+			counts[t.Category]++
+		}
+		defs := s.categories.List()
+		out := make([]categoryInfo, 0, len(defs))
+		for _, d := range defs {
+			out = append(out, categoryInfo{CategoryDef: d, Builtin: d.Name.Builtin(), Tracks: counts[d.Name]})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"categories": out,
+		})
+
+	case http.MethodPost:
+		var def library.CategoryDef
+		if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		def, err := s.categories.Create(def)
+		if err != nil {
+			writeCategoryError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(categoryInfo{CategoryDef: def})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// PATCH /api/categories/{name}
+// Body: {"label"?: string, "color"?: string, "rule"?: {...} | null}
+// Response: the updated category. The name itself can't change.
+//
+// DELETE /api/categories/{name}[?reassign={other}]
+// Deletes a user category. If files or classification rules are still filed
+// under it, reassign names the category they move to (files keep
+// manual/guessed as it was); without it the request fails with 409, the
+// number of files and the IDs of the rules.
+func (s *Server) handleCategory(w http.ResponseWriter, r *http.Request) {
+	name := library.Category(strings.TrimPrefix(r.URL.Path, "/api/categories/"))
+
+	switch r.Method {
+	case http.MethodPatch:
+		var body struct {
+			Label *string         `json:"label"`
+			Color *string         `json:"color"`
+			Rule  json.RawMessage `json:"rule"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		var rule *library.DurationRule
+		if len(body.Rule) > 0 {
+			if err := json.Unmarshal(body.Rule, &rule); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": fmt.Sprintf("Invalid rule: %v", err),
+				})
+				return
+			}
+		}
+		def, err := s.categories.Update(name, func(d *library.CategoryDef) {
+			if body.Label != nil {
+				d.Label = *body.Label
+			}
+			if body.Color != nil {
+				d.Color = *body.Color
+			}
+			if len(body.Rule) > 0 {
+				d.Rule = rule // null clears it
+			}
+		})
+		if err != nil {
+			writeCategoryError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(categoryInfo{CategoryDef: def, Builtin: def.Name.Builtin()})
+
+	case http.MethodDelete:
+		if name.Builtin() {
+			writeCategoryError(w, library.ErrBuiltinCategory)
+			return
+		}
+		reassign := library.Category(r.URL.Query().Get("reassign"))
+
+		// Everything happens inside one library batch, whose lock also
+		// covers setting a file's category, so no file (or rule) can be
+		// filed under name between the reassignment and the delete.
+		var deleted *library.CategoryDef
+		var inUse int
+		var rules []string
+		err := s.library.Batch(func(tx *library.Tx) error {
+			if !s.categories.Valid(name) {
+				return library.ErrCategoryNotFound
+			}
+			if reassign != "" && (reassign == name || !s.categories.Valid(reassign)) {
+				return errBadReassign
+			}
+			for _, n := range tx.Names() {
+				t, _ := tx.Get(n)
+				if t.Category != name {
+					continue
+				}
+				inUse++
+				if reassign != "" {
+					t.Category = reassign
+					tx.Put(n, t)
+				}
+			}
+			rules = s.rules.Using(name)
+			if (inUse > 0 || len(rules) > 0) && reassign == "" {
+				return errCategoryInUse
+			}
+			if err := s.rules.Reassign(name, reassign); err != nil {
+				return err
+			}
+			def, err := s.categories.Delete(name)
+			if err != nil {
+				return err
+			}
+			deleted = &def
+			return nil
+		})
+		if err != nil && deleted != nil {
+			// The files couldn't be saved: put the category back so they
+			// don't point at nothing.
+			if _, restoreErr := s.categories.Create(*deleted); restoreErr != nil {
+				log.Printf("Restore category %s after a failed delete: %v", name, restoreErr)
+			}
+		}
+		switch {
+		case errors.Is(err, errCategoryInUse):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":  fmt.Sprintf("%d files and %d rules use %q; pass ?reassign= to move them", inUse, len(rules), name),
+				"tracks": inUse,
+				"rules":  rules,
+			})
+			return
+		case errors.Is(err, errBadReassign):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("cannot reassign to %q", reassign),
+			})
+			return
+		case errors.Is(err, library.ErrCategoryNotFound):
+			writeCategoryError(w, err)
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to delete category: %v", err),
+			})
+			return
+		}
+		if inUse > 0 || len(rules) > 0 {
+			log.Printf("Deleted category %s, moved %d files and %d rules to %s", name, inUse, len(rules), reassign)
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "ok",
+			"reassigned": inUse,
+			"rules":      len(rules),
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+var (
+	errCategoryInUse = errors.New("category in use")
+	errBadReassign   = errors.New("invalid reassign target")
+)
+
+// writeCategoryError maps category store errors to a status code.
+func writeCategoryError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError // failed to save
+	switch {
+	case errors.Is(err, library.ErrInvalidCategory), errors.Is(err, library.ErrBuiltinCategory):
+		status = http.StatusBadRequest
+	case errors.Is(err, library.ErrCategoryExists):
+		status = http.StatusConflict
+	case errors.Is(err, library.ErrCategoryNotFound):
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestCategoryCRUD(t *testing.T) {
+	s, dir := newTestServer(t)
+
+	rec := do(t, s, http.MethodPost, "/api/categories", `{"name":"audiobook","label":"Audiobooks","color":"#112233","rule":{"min_seconds":7200}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	for body, want := range map[string]int{
+		`{"name":"audiobook"}`:                                  http.StatusConflict,
+		`{"name":"Bad Name"}`:                                   http.StatusBadRequest,
+		`{"name":"x","color":"red"}`:                            http.StatusBadRequest,
+		`{"name":"x","rule":{"min_seconds":5,"max_seconds":1}}`: http.StatusBadRequest,
+	} {
+		if rec := do(t, s, http.MethodPost, "/api/categories", body); rec.Code != want {
+			t.Errorf("POST %s = %d, want %d", body, rec.Code, want)
+		}
+	}
+
+	// New categories are valid for manual overrides and guessed by their rule.
+	if rec := do(t, s, http.MethodPost, "/api/files/song.mp3/category", `{"category":"audiobook"}`); rec.Code != http.StatusOK {
+		t.Fatalf("set category status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.categories.Classify(3*3600, 360); got != "audiobook" {
+		t.Fatalf("Classify(3h) = %q", got)
+	}
+	if got := s.categories.Classify(600, 360); got != library.CategoryPodcast {
+		t.Fatalf("Classify(10m) = %q", got)
+	}
+
+	rec = do(t, s, http.MethodPatch, "/api/categories/audiobook", `{"label":"Books","rule":null}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := s.categories.Classify(3*3600, 360); got != library.CategoryPodcast {
+		t.Fatalf("Classify(3h) after clearing the rule = %q", got)
+	}
+
+	// Persisted across restarts, with track counts.
+	s = NewServer(dir, dir, 360)
+	rec = do(t, s, http.MethodGet, "/api/categories", "")
+	var list struct {
+		Categories []categoryInfo `json:"categories"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Categories) != 3 || list.Categories[2].Label != "Books" || list.Categories[2].Tracks != 1 || !list.Categories[0].Builtin {
+		t.Fatalf("categories = %+v", list.Categories)
+	}
+
+	if rec := do(t, s, http.MethodDelete, "/api/categories/music", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("delete built-in status = %d", rec.Code)
+	}
+	rule, err := s.rules.Create(library.Rule{Category: "audiobook", Match: library.Match{MinSeconds: 7200}}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/categories/audiobook", ""); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), rule.ID) {
+		t.Fatalf("delete in-use = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/categories/audiobook?reassign=podcast", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete with reassign status = %d: %s", rec.Code, rec.Body)
+	}
+	if tr, _ := s.library.Get("song.mp3"); tr.Category != library.CategoryPodcast || tr.Source != library.SourceManual {
+		t.Fatalf("song.mp3 = %+v", tr)
+	}
+	if s.categories.Valid("audiobook") {
+		t.Fatal("deleted category still valid")
+	}
+	if got := s.rules.List(); len(got) != 1 || got[0].Category != library.CategoryPodcast {
+		t.Fatalf("rules = %+v, want the rule moved to podcast", got)
+	}
+}
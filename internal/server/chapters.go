@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/iwanhae/ytdl2/internal/command"
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// GET /api/files/{filename}/chapters
+// Response: {"name": string, "chapters": [{"start": float, "title": string}]}
+// PUT /api/files/{filename}/chapters
+// Body: {"chapters": [{"start": float, "title": string}]}
+// Reads or replaces the chapter list stored on the track. PUT is how users
+// correct detected chapters; an empty list clears them.
+func (s *Server) handleChapters(w http.ResponseWriter, r *http.Request, filename string) {
+	filePath, err := s.safePath(filename)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid filename",
+		})
+		return
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "File not found",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t, _ := s.library.Get(filename)
+		chapters := t.Chapters
+		if chapters == nil {
+			chapters = []library.Chapter{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":     filename,
+			"chapters": chapters,
+		})
+
+	case http.MethodPut:
+		var body struct {
+			Chapters []library.Chapter `json:"chapters"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+
+		t, _ := s.library.Get(filename)
+		chapters, err := library.NormalizeChapters(body.Chapters, t.Duration)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := s.library.Update(filename, func(t *library.Track) {
+			t.Chapters = chapters
+		}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to persist chapters: %v", err),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":     filename,
+			"chapters": chapters,
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// POST /api/files/{filename}/chapters/detect
+// Body (optional): {"noise_db": float, "min_silence": float, "min_chapter": float}
+// Runs ffmpeg silencedetect over the file as a tracked command and, when it
+// succeeds, replaces the track's chapters with one per detected silence. Any
+// option left out falls back to the server's configured defaults.
+func (s *Server) handleDetectChapters(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	filePath, err := s.safePath(filename)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid filename",
+		})
+		return
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "File not found",
+		})
+		return
+	}
+
+	opts := s.ChapterSilence
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	if opts.MinSilence <= 0 || opts.MinChapter < 0 || opts.NoiseDB >= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "min_silence must be positive, min_chapter non-negative and noise_db negative",
+		})
+		return
+	}
+
+	cmd := command.New("ffmpeg", library.SilenceDetectArgs(filePath, opts)...)
+	cmdID, err := s.runTracked(cmd, fmt.Sprintf("Detect chapters: %s", filename), func(exitCode int) {
+		if exitCode != 0 {
+			return
+		}
+		chapters := library.ChaptersFromSilence(cmd.Logs(), opts)
+		if err := s.library.Update(filename, func(t *library.Track) {
+			t.Chapters = chapters
+		}); err != nil {
+			log.Printf("Failed to persist chapters for %s: %v", filename, err)
+		}
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error executing ffmpeg: %v", err)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to detect chapters: %v", err),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+		"id":     cmdID,
+	})
+}
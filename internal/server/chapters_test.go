@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestChaptersPutAndGet(t *testing.T) {
+	s, _ := newTestServer(t)
+	do(t, s, http.MethodPost, "/api/files/song.mp3/category", `{"category":"podcast"}`)
+
+	rec := do(t, s, http.MethodPut, "/api/files/song.mp3/chapters",
+		`{"chapters":[{"start":95.5,"title":"Interview"},{"start":0,"title":""}]}`)
+	if rec.Code != 200 {
+		t.Fatalf("put status = %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/files/song.mp3/chapters", "")
+	var got struct {
+		Chapters []library.Chapter `json:"chapters"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []library.Chapter{{Start: 0, Title: "Chapter 1"}, {Start: 95.5, Title: "Interview"}}
+	if len(got.Chapters) != 2 || got.Chapters[0] != want[0] || got.Chapters[1] != want[1] {
+		t.Fatalf("chapters = %+v, want %+v", got.Chapters, want)
+	}
+
+	// Editing chapters must not disturb the category.
+	if tr, _ := s.library.Get("song.mp3"); tr.Category != library.CategoryPodcast || tr.Source != library.SourceManual {
+		t.Fatalf("track after chapter edit = %+v", tr)
+	}
+}
+
+func TestChaptersPutRejectsDuplicates(t *testing.T) {
+	s, _ := newTestServer(t)
+	rec := do(t, s, http.MethodPut, "/api/files/song.mp3/chapters",
+		`{"chapters":[{"start":10},{"start":10}]}`)
+	if rec.Code != 400 {
+		t.Fatalf("duplicate chapters status = %d, want 400", rec.Code)
+	}
+}
+
+func TestChaptersFromSilence(t *testing.T) {
+	lines := []string{
+		"[silencedetect @ 0x55d] silence_start: 30.1",
+		"[silencedetect @ 0x55d] silence_end: 32.4 | silence_duration: 2.3",
+		"[silencedetect @ 0x55d] silence_start: 118",
+		"[silencedetect @ 0x55d] silence_end: 121.25 | silence_duration: 3.25",
+		"size=N/A time=00:05:00.00 bitrate=N/A speed= 400x",
+	}
+	got := library.ChaptersFromSilence(lines, library.SilenceOptions{MinChapter: 60})
+	// 32.4 is too close to the start; 121.25 becomes chapter 2.
+	if len(got) != 2 || got[0].Start != 0 || got[1].Start != 121.25 || got[1].Title != "Chapter 2" {
+		t.Fatalf("chapters = %+v", got)
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// DirInfo represents a folder in a one-level listing.
+type DirInfo struct {
+	Name    string    `json:"name"` // relative to the download directory
+	ModTime time.Time `json:"mod_time"`
+}
+
+// resolveDir maps a folder path relative to the download directory ("" or "."
+// for the root) to its absolute path and its cleaned relative name.
+func (s *Server) resolveDir(dir string) (abs, rel string, err error) {
+	rel = filepath.Clean(strings.Trim(dir, "/"))
+	if rel == "." {
+		return filepath.Clean(s.DownloadDirectory), "", nil
+	}
+	if hasHiddenSegment(rel) {
+		return "", "", fmt.Errorf("invalid folder")
+	}
+	abs, err = s.safePath(rel)
+	if err != nil {
+		return "", "", err
+	}
+	return abs, rel, nil
+}
+
+// listDir returns the direct children of the folder at abs (relative name rel).
+func (s *Server) listDir(abs, rel string) ([]FileInfo, []DirInfo, error) {
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []FileInfo{}
+	dirs := []DirInfo{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // vanished since ReadDir
+		}
+		name := filepath.Join(rel, e.Name())
+		if e.IsDir() {
+			dirs = append(dirs, DirInfo{Name: name, ModTime: info.ModTime()})
+			continue
+		}
+		files = append(files, s.fileInfo(name, info))
+	}
+	return files, dirs, nil
+}
+
+// writeDirListing responds with the one-level listing of dir, its files
+// narrowed by filter.
+func (s *Server) writeDirListing(w http.ResponseWriter, dir string, filter fileFilter) {
+	abs, rel, err := s.resolveDir(dir)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid folder",
+		})
+		return
+	}
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Folder not found",
+		})
+		return
+	}
+
+	files, dirs, err := s.listDir(abs, rel)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to list folder: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":   rel,
+		"files": filter.apply(files),
+		"dirs":  dirs,
+	})
+}
+
+// handleDirs handles folder management
+// GET /api/dirs/{path} - List a folder's direct children (root if empty)
+// POST /api/dirs/{path} - Create a folder (and any missing parents)
+// POST /api/dirs/{path}/move - Rename or move a folder, body {"to": string}
+// DELETE /api/dirs/{path}[?confirm={path}] - Delete a folder and its contents
+func (s *Server) handleDirs(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/dirs"), "/")
+
+	if strings.HasSuffix(path, "/move") {
+		s.handleMoveDir(w, r, strings.TrimSuffix(path, "/move"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeDirListing(w, path, fileFilter{})
+
+	case http.MethodPost:
+		abs, rel, err := s.resolveDir(path)
+		if err != nil || rel == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid folder",
+			})
+			return
+		}
+		if _, err := os.Stat(abs); err == nil {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Already exists",
+			})
+			return
+		}
+		if err := os.MkdirAll(abs, 0o755); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to create folder: %v", err),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"name": rel,
+		})
+
+	case http.MethodDelete:
+		s.handleDeleteDir(w, r, path)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// DELETE /api/dirs/{path}[?confirm={path}]
+// Empty folders are removed outright. A folder with files in it is only
+// removed when ?confirm repeats its path; otherwise the response is 409 with
+// the number of files that would be deleted, so clients can ask the user.
+// Also 409 while any file inside is having its tags edited.
+func (s *Server) handleDeleteDir(w http.ResponseWriter, r *http.Request, dir string) {
+	abs, rel, err := s.resolveDir(dir)
+	if err != nil || rel == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid folder",
+		})
+		return
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Folder not found",
+		})
+		return
+	}
+
+	files, err := filesUnder(abs, rel)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to read folder: %v", err),
+		})
+		return
+	}
+	unlock, ok := s.lockFiles(files)
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": errFileBusy,
+		})
+		return
+	}
+	defer unlock()
+	if len(files) > 0 && filepath.Clean(strings.Trim(r.URL.Query().Get("confirm"), "/")) != rel {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": fmt.Sprintf("Folder is not empty; repeat the request with ?confirm=%s to delete %d files", rel, len(files)),
+			"files": len(files),
+		})
+		return
+	}
+
+	if err := os.RemoveAll(abs); err != nil {
+		log.Printf("Failed to delete folder %s: %v", abs, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to delete folder: %v", err),
+		})
+		return
+	}
+	for _, name := range files {
+		s.deleteDerived(name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Folder deleted successfully",
+		"files":   len(files),
+	})
+}
+
+// POST /api/dirs/{path}/move
+// Body: {"to": string}
+// Renames or moves a folder, creating the destination's parents. Refuses to
+// overwrite an existing path or to move a folder into itself. Metadata and
+// caches of every file inside are re-keyed to the new names. Answers 409
+// while any file inside is having its tags edited.
+func (s *Server) handleMoveDir(w http.ResponseWriter, r *http.Request, dir string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	srcAbs, srcRel, err := s.resolveDir(dir)
+	if err != nil || srcRel == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid folder",
+		})
+		return
+	}
+	if info, err := os.Stat(srcAbs); err != nil || !info.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Folder not found",
+		})
+		return
+	}
+
+	var body struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	dstAbs, dstRel, err := s.resolveDir(body.To)
+	if err != nil || dstRel == "" || dstRel == srcRel || strings.HasPrefix(dstRel, srcRel+string(os.PathSeparator)) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid destination",
+		})
+		return
+	}
+	files, err := filesUnder(srcAbs, srcRel)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to read folder: %v", err),
+		})
+		return
+	}
+	unlock, ok := s.lockFiles(files)
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": errFileBusy,
+		})
+		return
+	}
+	defer unlock()
+	if err := os.MkdirAll(filepath.Dir(dstAbs), 0o755); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to move folder: %v", err),
+		})
+		return
+	}
+	// A plain rename would replace an empty folder at the destination.
+	if err := fsutil.RenameNoReplace(srcAbs, dstAbs); os.IsExist(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Destination already exists",
+		})
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to move folder: %v", err),
+		})
+		return
+	}
+	for _, name := range files {
+		s.renameDerived(name, dstRel+strings.TrimPrefix(name, srcRel))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":     dstRel,
+		"old_name": srcRel,
+		"files":    len(files),
+	})
+}
+
+// filesUnder lists the relative names of every file below the folder at abs
+// (relative name rel), including hidden ones, so their metadata can follow a
+// move or be pruned on delete.
+func filesUnder(abs, rel string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		sub, err := filepath.Rel(abs, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.Join(rel, sub))
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type dirResp struct {
+	Files []fileItem `json:"files"`
+	Dirs  []struct {
+		Name string `json:"name"`
+	} `json:"dirs"`
+}
+
+func TestListFilesOneLevel(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.MkdirAll(filepath.Join(dir, "shows", "deep"), 0o755)
+	os.WriteFile(filepath.Join(dir, "shows", "ep1.mp3"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(dir, "shows", "deep", "ep0.mp3"), []byte("x"), 0o644)
+
+	var root dirResp
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/files?dir=", "").Body.Bytes(), &root)
+	if len(root.Files) != 1 || root.Files[0].Name != "song.mp3" || len(root.Dirs) != 1 || root.Dirs[0].Name != "shows" {
+		t.Fatalf("root listing = %+v", root)
+	}
+
+	var shows dirResp
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/dirs/shows", "").Body.Bytes(), &shows)
+	if len(shows.Files) != 1 || shows.Files[0].Name != "shows/ep1.mp3" || len(shows.Dirs) != 1 || shows.Dirs[0].Name != "shows/deep" {
+		t.Fatalf("shows listing = %+v", shows)
+	}
+
+	if rec := do(t, s, http.MethodGet, "/api/files?dir=../", ""); rec.Code != 400 {
+		t.Fatalf("traversal status = %d, want 400", rec.Code)
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files?dir=.ytdl2", ""); rec.Code != 400 {
+		t.Fatalf("sidecar listing status = %d, want 400", rec.Code)
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files?dir=song.mp3", ""); rec.Code != 404 {
+		t.Fatalf("file listing status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDirCreateMoveDelete(t *testing.T) {
+	s, dir := newTestServer(t)
+	if rec := do(t, s, http.MethodPost, "/api/dirs/a/b", ""); rec.Code != 201 {
+		t.Fatalf("mkdir status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, s, http.MethodPost, "/api/dirs/a/b", ""); rec.Code != 409 {
+		t.Fatalf("second mkdir status = %d, want 409", rec.Code)
+	}
+	do(t, s, http.MethodPost, "/api/files/song.mp3/move", `{"to":"a/b/song.mp3"}`)
+	do(t, s, http.MethodPost, "/api/files/a/b/song.mp3/category", `{"category":"music"}`)
+
+	os.Mkdir(filepath.Join(dir, "empty"), 0o755)
+	if rec := do(t, s, http.MethodPost, "/api/dirs/a/move", `{"to":"empty"}`); rec.Code != 409 {
+		t.Fatalf("move onto an empty folder status = %d, want 409", rec.Code)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/dirs/a/move", `{"to":"a/b/c"}`); rec.Code != 400 {
+		t.Fatalf("move into self status = %d, want 400", rec.Code)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/dirs/a/move", `{"to":"z"}`); rec.Code != 200 {
+		t.Fatalf("move status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if tr, ok := s.library.Get("z/b/song.mp3"); !ok || tr.Category != "music" {
+		t.Fatalf("metadata not re-keyed: %+v %v", tr, ok)
+	}
+
+	if rec := do(t, s, http.MethodDelete, "/api/dirs/z", ""); rec.Code != 409 {
+		t.Fatalf("unconfirmed delete status = %d, want 409", rec.Code)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/dirs/z?confirm=z", ""); rec.Code != 200 {
+		t.Fatalf("confirmed delete status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "z")); !os.IsNotExist(err) {
+		t.Fatalf("folder still there: %v", err)
+	}
+	if _, ok := s.library.Get("z/b/song.mp3"); ok {
+		t.Fatal("store entry not pruned")
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/dirs/", ""); rec.Code != 400 {
+		t.Fatalf("root delete status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// GET /api/library/duplicates
+// Response: {"groups": [{"sha256": string, "size": int64, "files": [FileInfo]}]}
+// Groups files with identical content (full SHA-256, narrowed by size and a
+// partial hash first). Hashes are cached on the tracks, so repeat calls only
+// hash new or changed files.
+func (s *Server) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	groups, err := s.library.FindDuplicates(s.DownloadDirectory)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to find duplicates: %v", err),
+		})
+		return
+	}
+
+	type group struct {
+		SHA256 string     `json:"sha256"`
+		Size   int64      `json:"size"`
+		Files  []FileInfo `json:"files"`
+	}
+	out := make([]group, 0, len(groups))
+	for _, g := range groups {
+		files := make([]FileInfo, 0, len(g.Files))
+		for _, name := range g.Files {
+			filePath, err := s.safePath(name)
+			if err != nil {
+				continue
+			}
+			info, err := os.Stat(filePath)
+			if err != nil {
+				continue // deleted since the scan
+			}
+			files = append(files, s.fileInfo(name, info))
+		}
+		if len(files) > 1 {
+			out = append(out, group{SHA256: g.SHA256, Size: g.Size, Files: files})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups": out,
+	})
+}
+
+// POST /api/library/duplicates/resolve
+// Body: {"groups": [{"keep": string, "delete": [string]}]}
+// Response: {"deleted": [string], "errors": [{"name": string, "error": string}]}
+// Keeps one copy of each group and deletes the rest. Every file to delete is
+// re-hashed against the kept copy first, so stale hashes can never delete
+// something that isn't an exact duplicate. The kept copy's metadata is left
+// as is, except that it inherits a manual category or chapters from a deleted
+// copy when it has none of its own.
+func (s *Server) handleResolveDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		Groups []struct {
+			Keep   string   `json:"keep"`
+			Delete []string `json:"delete"`
+		} `json:"groups"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+
+	type failure struct {
+		Name  string `json:"name"`
+		Error string `json:"error"`
+	}
+	deleted := []string{}
+	failures := []failure{}
+	for _, g := range body.Groups {
+		keepPath, err := s.safePath(g.Keep)
+		if err != nil {
+			failures = append(failures, failure{g.Keep, "invalid filename"})
+			continue
+		}
+		keepSum, err := library.HashFile(keepPath)
+		if err != nil {
+			failures = append(failures, failure{g.Keep, err.Error()})
+			continue
+		}
+		for _, name := range g.Delete {
+			filePath, err := s.safePath(name)
+			if err != nil || filePath == keepPath {
+				failures = append(failures, failure{name, "invalid filename"})
+				continue
+			}
+			sum, err := library.HashFile(filePath)
+			if err != nil {
+				failures = append(failures, failure{name, err.Error()})
+				continue
+			}
+			if sum != keepSum {
+				failures = append(failures, failure{name, "content differs from " + g.Keep})
+				continue
+			}
+
+			dup, _ := s.library.Get(name)
+			if err := os.Remove(filePath); err != nil {
+				log.Printf("Failed to delete duplicate %s: %v", filePath, err)
+				failures = append(failures, failure{name, err.Error()})
+				continue
+			}
+			s.inheritMetadata(g.Keep, dup)
+			s.deleteDerived(name)
+			deleted = append(deleted, name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+		"errors":  failures,
+	})
+}
+
+// inheritMetadata copies user-entered metadata from a deleted duplicate onto
+// the kept copy where the kept copy has none.
+func (s *Server) inheritMetadata(keep string, dup library.Track) {
+	if dup.Source != library.SourceManual && len(dup.Chapters) == 0 {
+		return
+	}
+	if err := s.library.Update(keep, func(t *library.Track) {
+		if dup.Source == library.SourceManual && t.Source != library.SourceManual {
+			t.Category = dup.Category
+			t.Source = library.SourceManual
+		}
+		if len(t.Chapters) == 0 {
+			t.Chapters = dup.Chapters
+		}
+	}); err != nil {
+		log.Printf("Failed to merge metadata into %s: %v", keep, err)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestDuplicatesFindAndResolve(t *testing.T) {
+	s, dir := newTestServer(t)
+	// song.mp3 holds "fake audio"; two copies plus a same-size impostor.
+	os.MkdirAll(filepath.Join(dir, "copies"), 0o755)
+	os.WriteFile(filepath.Join(dir, "copies", "song (1).mp3"), []byte("fake audio"), 0o644)
+	os.WriteFile(filepath.Join(dir, "song-copy.mp3"), []byte("fake audio"), 0o644)
+	os.WriteFile(filepath.Join(dir, "impostor.mp3"), []byte("fake AUDIO"), 0o644)
+	s.library.Set("song.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceGuessed})
+	do(t, s, http.MethodPost, "/api/files/song-copy.mp3/category", `{"category":"podcast"}`)
+
+	rec := do(t, s, http.MethodGet, "/api/library/duplicates", "")
+	var dr struct {
+		Groups []struct {
+			SHA256 string     `json:"sha256"`
+			Files  []fileItem `json:"files"`
+		} `json:"groups"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &dr)
+	if rec.Code != 200 || len(dr.Groups) != 1 || len(dr.Groups[0].Files) != 3 {
+		t.Fatalf("duplicates status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if tr, _ := s.library.Get("song.mp3"); tr.SHA256 != dr.Groups[0].SHA256 {
+		t.Fatalf("hash not cached on track: %+v", tr)
+	}
+	if tr, ok := s.library.Get(filepath.Join("copies", "song (1).mp3")); ok {
+		t.Fatalf("untracked copy was added to the library: %+v", tr)
+	}
+
+	rec = do(t, s, http.MethodPost, "/api/library/duplicates/resolve",
+		`{"groups":[{"keep":"song.mp3","delete":["copies/song (1).mp3","song-copy.mp3","impostor.mp3"]}]}`)
+	var rr struct {
+		Deleted []string `json:"deleted"`
+		Errors  []struct {
+			Name string `json:"name"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &rr)
+	if len(rr.Deleted) != 2 || len(rr.Errors) != 1 || rr.Errors[0].Name != "impostor.mp3" {
+		t.Fatalf("resolve = %s", rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "impostor.mp3")); err != nil {
+		t.Fatal("non-duplicate was deleted")
+	}
+	// The kept copy inherits the manual category of the deleted one.
+	if tr, _ := s.library.Get("song.mp3"); tr.Category != "podcast" || tr.Source != "manual" {
+		t.Fatalf("kept track = %+v", tr)
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/feed"
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// mediaTypes covers extensions the system MIME table often lacks or gets
+// wrong for podcast apps.
+var mediaTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".aac":  "audio/aac",
+	".opus": "audio/ogg",
+	".ogg":  "audio/ogg",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+}
+
+func mediaType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// GET /feeds/{category}.xml - Every file in a category
+// GET /feeds/tags/{tag}.xml - Every file with a tag
+// GET /feeds/dirs/{folder}.xml - Every file in a folder and its subfolders
+// An RSS 2.0 podcast feed (with iTunes tags) to subscribe to in any podcast
+// app, newest first. Enclosures stream from /api/files/{name}; episodes are
+// dated by when they were downloaded. Each episode's GUID is the one its
+// library entry was given when first stored, so it stays the same when the
+// file is moved or renamed; files the library hasn't stored yet are left out
+// until it has. The filter parameters of GET /api/files narrow
+// any feed further, e.g. ?status=unplayed.
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	spec, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/feeds/"), ".xml")
+	if !ok || spec == "" {
+		http.NotFound(w, r)
+		return
+	}
+	filter, err := parseFileFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var ch feed.Channel
+	var keep func(fi FileInfo) bool
+	kind, rest, nested := strings.Cut(spec, "/")
+	switch {
+	case !nested:
+		category := library.Category(spec)
+		if !s.categories.Valid(category) {
+			http.NotFound(w, r)
+			return
+		}
+		label := spec
+		for _, d := range s.categories.List() {
+			if d.Name == category {
+				label = d.Label
+			}
+		}
+		ch.Title = label
+		ch.Description = fmt.Sprintf("%s downloaded with ytdl2", label)
+		keep = func(fi FileInfo) bool { return fi.Category == spec }
+	case kind == "tags":
+		tags, err := library.NormalizeTags([]string{rest})
+		if err != nil || len(tags) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+		tag := tags[0]
+		ch.Title = "#" + tag
+		ch.Description = fmt.Sprintf("Files tagged %s in ytdl2", tag)
+		keep = func(fi FileInfo) bool { return slices.Contains(fi.Tags, tag) }
+	case kind == "dirs":
+		abs, rel, err := s.resolveDir(rest)
+		if err != nil || rel == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		ch.Title = filepath.Base(rel)
+		ch.Description = fmt.Sprintf("%s, downloaded with ytdl2", rel)
+		prefix := rel + string(filepath.Separator)
+		keep = func(fi FileInfo) bool { return strings.HasPrefix(fi.Name, prefix) }
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	files, err := s.listAllFiles()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to list files: %v", err),
+		})
+		return
+	}
+	base := baseURL(r)
+	ch.Link = base + "/"
+	ch.Image = base + "/icon-512.png"
+	ch.Author = "ytdl2"
+	for _, fi := range filter.apply(files) {
+		if keep(fi) {
+			if t, ok := s.library.Get(fi.Name); ok {
+				ch.Items = append(ch.Items, feedItem(base, fi, t.GUID))
+			}
+		}
+	}
+	slices.SortStableFunc(ch.Items, func(a, b feed.Item) int {
+		return b.Published.Compare(a.Published)
+	})
+
+	var buf bytes.Buffer
+	if err := feed.WriteRSS(&buf, ch); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to write feed: %v", err),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// feedItem describes a library file as a podcast episode. Its GUID is the
+// source feed's for subscription downloads, else guid, the track's own.
+func feedItem(base string, fi FileInfo, guid string) feed.Item {
+	item := playlistItem(base, fi)
+	published := fi.Added
+	if published.IsZero() {
+		published = fi.ModTime // added before download times were recorded
+	}
+	it := feed.Item{
+		GUID:        guid,
+		Title:       item.Title,
+		Link:        fi.Meta.URL,
+		Description: fi.Meta.Comment,
+		Published:   published,
+		Duration:    fi.Duration,
+		Enclosure: feed.Enclosure{
+			URL:    item.Location,
+			Length: fi.Size,
+			Type:   mediaType(fi.Name),
+		},
+	}
+	if e := fi.Episode; e != nil {
+		it.Description = cmp.Or(it.Description, e.Notes)
+		it.Link = cmp.Or(it.Link, e.Link)
+		it.GUID = cmp.Or(e.GUID, it.GUID)
+	}
+	if fi.ArtURL != "" {
+		it.Image = base + fi.ArtURL
+	}
+	return it
+}
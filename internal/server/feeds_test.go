@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+type feedDoc struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title     string `xml:"title"`
+			GUID      string `xml:"guid"`
+			PubDate   string `xml:"pubDate"`
+			Duration  string `xml:"duration"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Length int64  `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func getFeed(t *testing.T, s *Server, target string) feedDoc {
+	t.Helper()
+	rec := do(t, s, http.MethodGet, target, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", target, rec.Code, rec.Body)
+	}
+	var doc feedDoc
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return doc
+}
+
+func titles(doc feedDoc) []string {
+	var out []string
+	for _, it := range doc.Channel.Items {
+		out = append(out, it.Title)
+	}
+	return out
+}
+
+func TestFeeds(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.MkdirAll(filepath.Join(dir, "Show"), 0o755)
+	os.WriteFile(filepath.Join(dir, "Show", "ep 1.mp3"), []byte("episode one"), 0o644)
+	os.WriteFile(filepath.Join(dir, "Show", "ep2.m4a"), []byte("episode two!"), 0o644)
+	added := time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC)
+	s.library.Set("Show/ep 1.mp3", library.Track{Category: library.CategoryPodcast, Duration: 3725, Added: added})
+	s.library.Set("Show/ep2.m4a", library.Track{Category: library.CategoryPodcast, Added: added.Add(24 * time.Hour), Meta: library.Metadata{Title: "Second"}})
+	s.library.Set("song.mp3", library.Track{Category: library.CategoryMusic, Tags: []string{"workout"}})
+
+	doc := getFeed(t, s, "/feeds/podcast.xml")
+	if got := titles(doc); !slices.Equal(got, []string{"Second", "ep 1"}) {
+		t.Fatalf("podcast feed = %v, want newest first", got)
+	}
+	ep := doc.Channel.Items[1]
+	if ep.Enclosure.URL != "http://example.com/api/files/Show/ep%201.mp3" || ep.Enclosure.Length != int64(len("episode one")) || ep.Enclosure.Type != "audio/mpeg" {
+		t.Fatalf("enclosure = %+v", ep.Enclosure)
+	}
+	if ep.Duration != "1:02:05" || ep.PubDate != "Tue, 05 Mar 2024 06:07:08 +0000" {
+		t.Fatalf("duration/pubDate = %q %q", ep.Duration, ep.PubDate)
+	}
+
+	// GUIDs don't change between fetches.
+	if again := getFeed(t, s, "/feeds/dirs/Show.xml"); again.Channel.Title != "Show" || again.Channel.Items[1].GUID != ep.GUID {
+		t.Fatalf("folder feed = %+v", again.Channel)
+	}
+	// ...nor when the file is moved.
+	if rec := do(t, s, http.MethodPost, "/api/files/Show/ep%201.mp3/move", `{"to":"Show/episode 1.mp3"}`); rec.Code != http.StatusOK {
+		t.Fatalf("move = %d: %s", rec.Code, rec.Body)
+	}
+	if moved := getFeed(t, s, "/feeds/podcast.xml").Channel.Items[1]; moved.Enclosure.URL == ep.Enclosure.URL || moved.GUID != ep.GUID {
+		t.Fatalf("after move: %+v, want GUID %q", moved, ep.GUID)
+	}
+	// A new file under the old name is a new episode.
+	os.WriteFile(filepath.Join(dir, "Show", "ep 1.mp3"), []byte("another one"), 0o644)
+	s.library.Set("Show/ep 1.mp3", library.Track{Category: library.CategoryPodcast, Added: added.Add(48 * time.Hour)})
+	if reused := getFeed(t, s, "/feeds/podcast.xml").Channel.Items[0]; reused.Enclosure.URL != ep.Enclosure.URL || reused.GUID == ep.GUID {
+		t.Fatalf("new file at old name: %+v, want a GUID other than %q", reused, ep.GUID)
+	}
+	if got := titles(getFeed(t, s, "/feeds/tags/workout.xml")); !slices.Equal(got, []string{"song"}) {
+		t.Fatalf("tag feed = %v", got)
+	}
+	if got := titles(getFeed(t, s, "/feeds/music.xml?tag_none=workout")); got != nil {
+		t.Fatalf("filtered feed = %v, want empty", got)
+	}
+
+	for _, target := range []string{"/feeds/nosuch.xml", "/feeds/dirs/missing.xml", "/feeds/podcast", "/feeds/other/x.xml"} {
+		if rec := do(t, s, http.MethodGet, target, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// fileFilter narrows a file listing by query parameters. The zero value
+// keeps everything.
+type fileFilter struct {
+	tags     library.TagQuery
+	statuses []library.PlayStatus
+	minPlays int
+}
+
+// parseFileFilter reads the filter parameters of GET /api/files:
+//
+//	tag_any=a,b   carries at least one of the tags
+//	tag_all=a,b   carries every tag
+//	tag_none=a,b  carries none of the tags
+//	status=s1,s2  has one of the play statuses (unplayed, in_progress, played)
+//	min_plays=n   was played to the end at least n times
+func parseFileFilter(query url.Values) (fileFilter, error) {
+	var f fileFilter
+	for _, p := range []struct {
+		param string
+		dst   *[]string
+	}{
+		{"tag_any", &f.tags.Any},
+		{"tag_all", &f.tags.All},
+		{"tag_none", &f.tags.None},
+	} {
+		if !query.Has(p.param) {
+			continue
+		}
+		tags, err := library.NormalizeTags(strings.Split(query.Get(p.param), ","))
+		if err != nil {
+			return f, err
+		}
+		*p.dst = tags
+	}
+	if query.Has("status") {
+		for _, st := range strings.Split(query.Get("status"), ",") {
+			status := library.PlayStatus(strings.TrimSpace(st))
+			if !status.Valid() {
+				return f, fmt.Errorf("unknown status %q", st)
+			}
+			f.statuses = append(f.statuses, status)
+		}
+	}
+	if query.Has("min_plays") {
+		n, err := strconv.Atoi(query.Get("min_plays"))
+		if err != nil || n < 0 {
+			return f, errors.New("min_plays must be a non-negative integer")
+		}
+		f.minPlays = n
+	}
+	return f, nil
+}
+
+// keep reports whether fi passes the filter.
+func (f fileFilter) keep(fi FileInfo) bool {
+	if !f.tags.Empty() && !f.tags.Matches(fi.Tags) {
+		return false
+	}
+	if len(f.statuses) > 0 && !slices.Contains(f.statuses, fi.PlayStatus) {
+		return false
+	}
+	if f.minPlays > 0 && (fi.Progress == nil || fi.Progress.Plays < f.minPlays) {
+		return false
+	}
+	return true
+}
+
+// apply returns the files that pass the filter, reusing files' storage.
+func (f fileFilter) apply(files []FileInfo) []FileInfo {
+	kept := files[:0]
+	for _, fi := range files {
+		if f.keep(fi) {
+			kept = append(kept, fi)
+		}
+	}
+	return kept
+}
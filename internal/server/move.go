@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// errDestinationExists is returned by moveFile when the target is taken.
+var errDestinationExists = errors.New("destination already exists")
+
+// POST /api/files/{filename}/move
+// Body: {"to": string}
+// Renames or moves a file to another path under the download directory,
+// creating intermediate directories. Never overwrites an existing file. The
+// file's library entry, playback position, playlist entries, subscription
+// episode, waveform and artwork follow it to the new name.
+// Answers 409 while the file's tags are being edited.
+// Response: {"name": string, "old_name": string}
+func (s *Server) handleMoveFile(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	srcPath, err := s.safePath(filename)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid filename",
+		})
+		return
+	}
+
+	info, err := os.Stat(srcPath)
+	if os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "File not found",
+		})
+		return
+	}
+	if err == nil && info.IsDir() {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Not a file",
+		})
+		return
+	}
+
+	var body struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+
+	dstPath, err := s.safePath(body.To)
+	if err != nil || dstPath == filepath.Clean(s.DownloadDirectory) || hasHiddenSegment(body.To) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid destination",
+		})
+		return
+	}
+	oldName, _ := filepath.Rel(filepath.Clean(s.DownloadDirectory), srcPath)
+	newName, _ := filepath.Rel(filepath.Clean(s.DownloadDirectory), dstPath)
+
+	unlock, ok := s.lockFiles([]string{oldName})
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": errFileBusy,
+		})
+		return
+	}
+	defer unlock()
+
+	if err := moveFile(srcPath, dstPath); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errDestinationExists) {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to move file: %v", err),
+		})
+		return
+	}
+	s.renameDerived(oldName, newName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":     newName,
+		"old_name": oldName,
+	})
+}
+
+// errFileBusy is the 409 message for moving or deleting a file whose tags are
+// being rewritten.
+const errFileBusy = "A file is busy having its tags edited; try again when that finishes"
+
+// lockFiles takes s.fileLocks for every name without waiting. If any is held
+// it takes none and returns ok == false; otherwise unlock releases them all.
+func (s *Server) lockFiles(names []string) (unlock func(), ok bool) {
+	unlocks := make([]func(), 0, len(names))
+	unlock = func() {
+		for _, u := range unlocks {
+			u()
+		}
+	}
+	for _, name := range names {
+		u, ok := s.fileLocks.TryLock(name)
+		if !ok {
+			unlock()
+			return nil, false
+		}
+		unlocks = append(unlocks, u)
+	}
+	return unlock, true
+}
+
+// moveFile renames src to dst without clobbering (see
+// fsutil.RenameNoReplace), creating dst's parent directories.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := fsutil.RenameNoReplace(src, dst); os.IsExist(err) {
+		return errDestinationExists
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// renameDerived re-keys everything we keep about oldName — the library entry
+// and all of followRename's — after the file moved to newName. Failures are
+// logged: the file itself has already moved.
+func (s *Server) renameDerived(oldName, newName string) {
+	if err := s.library.Rename(oldName, newName); err != nil {
+		log.Printf("Failed to re-key library entry %s -> %s: %v", oldName, newName, err)
+	}
+	s.followRename(oldName, newName)
+}
+
+// deleteDerived drops everything we keep about a deleted file: the library
+// entry and all of followDelete's. Best-effort: failures are logged.
+func (s *Server) deleteDerived(name string) {
+	if err := s.library.Delete(name); err != nil {
+		log.Printf("Failed to prune library entry for %s: %v", name, err)
+	}
+	s.followDelete(name)
+}
+
+// followRename re-keys what we keep about a file outside the library store —
+// playback state, playlist entries, subscription episodes and the cached
+// waveform and artwork — after it moved. Reconcile uses it directly, as the
+// library has already moved its entry by then.
+func (s *Server) followRename(oldName, newName string) {
+	s.playback.Rename(oldName, newName)
+	if err := s.playlists.RenameFile(oldName, newName); err != nil {
+		log.Printf("Failed to re-point playlist entries %s -> %s: %v", oldName, newName, err)
+	}
+	if err := s.subscriptions.RenameFile(oldName, newName); err != nil {
+		log.Printf("Failed to re-point subscription episode %s -> %s: %v", oldName, newName, err)
+	}
+	if err := s.waveforms.Rename(oldName, newName); err != nil {
+		log.Printf("Failed to re-key waveform %s -> %s: %v", oldName, newName, err)
+	}
+	if err := s.artwork.Rename(oldName, newName); err != nil {
+		log.Printf("Failed to re-key artwork %s -> %s: %v", oldName, newName, err)
+	}
+}
+
+// followDelete drops what followRename re-keys, after the file was deleted.
+func (s *Server) followDelete(name string) {
+	s.playback.Delete(name)
+	if err := s.playlists.RemoveFile(name); err != nil {
+		log.Printf("Failed to drop playlist entries for %s: %v", name, err)
+	}
+	if err := s.subscriptions.RemoveFile(name); err != nil {
+		log.Printf("Failed to drop subscription episode %s: %v", name, err)
+	}
+	if err := s.waveforms.Delete(name); err != nil {
+		log.Printf("Failed to prune waveform for %s: %v", name, err)
+	}
+	if err := s.artwork.Delete(name); err != nil {
+		log.Printf("Failed to prune artwork for %s: %v", name, err)
+	}
+}
+
+// hasHiddenSegment reports whether any path segment is a dotfile. Such files
+// are hidden from listings and scans, so we don't create them.
+func hasHiddenSegment(name string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(filepath.Clean(name)), "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/art"
+)
+
+func TestMoveFileRekeysMetadata(t *testing.T) {
+	s, dir := newTestServer(t)
+	do(t, s, http.MethodPost, "/api/files/song.mp3/category", `{"category":"music"}`)
+	artPath := s.artwork.Path("song.mp3", art.SizeLarge)
+	os.MkdirAll(filepath.Dir(artPath), 0o755)
+	os.WriteFile(artPath, []byte("jpeg"), 0o644)
+
+	rec := do(t, s, http.MethodPost, "/api/files/song.mp3/move", `{"to":"albums/best/song.mp3"}`)
+	if rec.Code != 200 {
+		t.Fatalf("move status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "albums", "best", "song.mp3")); err != nil {
+		t.Fatalf("moved file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "song.mp3")); !os.IsNotExist(err) {
+		t.Fatalf("source still present: %v", err)
+	}
+	if _, ok := s.library.Get("song.mp3"); ok {
+		t.Fatal("old store key still present")
+	}
+	if tr, ok := s.library.Get("albums/best/song.mp3"); !ok || tr.Category != "music" {
+		t.Fatalf("new store entry = %+v, %v", tr, ok)
+	}
+	if _, err := os.Stat(s.artwork.Path("albums/best/song.mp3", art.SizeLarge)); err != nil {
+		t.Fatalf("artwork not re-keyed: %v", err)
+	}
+}
+
+func TestMoveFileRefusesClobberAndEscape(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.WriteFile(filepath.Join(dir, "other.mp3"), []byte("other"), 0o644)
+
+	if rec := do(t, s, http.MethodPost, "/api/files/song.mp3/move", `{"to":"other.mp3"}`); rec.Code != 409 {
+		t.Fatalf("clobber status = %d, want 409", rec.Code)
+	}
+	for _, to := range []string{"../escape.mp3", ".ytdl2/x.mp3", "dir/.hidden.mp3", ""} {
+		if rec := do(t, s, http.MethodPost, "/api/files/song.mp3/move", `{"to":"`+to+`"}`); rec.Code != 400 {
+			t.Fatalf("move to %q status = %d, want 400", to, rec.Code)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "other.mp3")); string(data) != "other" {
+		t.Fatalf("destination clobbered: %q", data)
+	}
+}
+
+func TestMoveAndDeleteWaitForTagEdit(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.MkdirAll(filepath.Join(dir, "shows"), 0o755)
+	os.WriteFile(filepath.Join(dir, "shows", "ep.mp3"), []byte("x"), 0o644)
+
+	unlock, _ := s.fileLocks.TryLock("song.mp3")
+	for _, c := range []struct{ method, target, body string }{
+		{http.MethodPost, "/api/files/song.mp3/move", `{"to":"moved.mp3"}`},
+		{http.MethodDelete, "/api/files/song.mp3", ""},
+	} {
+		if rec := do(t, s, c.method, c.target, c.body); rec.Code != http.StatusConflict {
+			t.Fatalf("%s %s status = %d, want 409 (body=%s)", c.method, c.target, rec.Code, rec.Body.String())
+		}
+	}
+	unlock()
+	if _, err := os.Stat(filepath.Join(dir, "song.mp3")); err != nil {
+		t.Fatalf("busy file touched: %v", err)
+	}
+
+	unlock, _ = s.fileLocks.TryLock("shows/ep.mp3")
+	if rec := do(t, s, http.MethodPost, "/api/dirs/shows/move", `{"to":"other"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("dir move status = %d, want 409", rec.Code)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/dirs/shows?confirm=shows", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("dir delete status = %d, want 409", rec.Code)
+	}
+	unlock()
+	if rec := do(t, s, http.MethodPost, "/api/dirs/shows/move", `{"to":"other"}`); rec.Code != http.StatusOK {
+		t.Fatalf("dir move after edit status = %d body=%s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+	"github.com/iwanhae/ytdl2/internal/playlist"
+)
+
+// maxPlaylistImport bounds uploaded playlist files.
+const maxPlaylistImport = 5 << 20
+
+// playlistFormat is an export format, chosen by file extension.
+type playlistFormat struct {
+	contentType string
+	write       func(w io.Writer, title string, items []playlist.Item) error
+}
+
+var playlistFormats = map[string]playlistFormat{
+	".m3u8": {"audio/x-mpegurl; charset=utf-8", playlist.WriteM3U},
+	".m3u":  {"audio/x-mpegurl; charset=utf-8", playlist.WriteM3U},
+	".xspf": {"application/xspf+xml; charset=utf-8", playlist.WriteXSPF},
+}
+
+// splitPlaylistFormat splits a known playlist extension off name.
+func splitPlaylistFormat(name string) (string, playlistFormat, bool) {
+	ext := path.Ext(name)
+	format, ok := playlistFormats[strings.ToLower(ext)]
+	if !ok {
+		return name, playlistFormat{}, false
+	}
+	return strings.TrimSuffix(name, ext), format, true
+}
+
+// baseURL is the scheme and host clients reached us at, honoring the
+// X-Forwarded-Proto/X-Forwarded-Host headers a reverse proxy sets. Exported
+// playlists need absolute URLs because players fetch them outside the browser.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host, _, _ = strings.Cut(fwd, ",")
+		host = strings.TrimSpace(host)
+	}
+	return scheme + "://" + host
+}
+
+// playlistItem describes a library file for an exported playlist. Untagged
+// files are titled as their feed had them, or by their file name.
+func playlistItem(base string, fi FileInfo) playlist.Item {
+	title := fi.Meta.Title
+	if title == "" && fi.Episode != nil {
+		title = fi.Episode.Title
+	}
+	if title == "" {
+		title = fileStem(fi.Name)
+	}
+	return playlist.Item{
+		Location: base + fileURL(fi.Name),
+		Title:    title,
+		Artist:   fi.Meta.Artist,
+		Album:    fi.Meta.Album,
+		Duration: fi.Duration,
+	}
+}
+
+// fileStem is the base name of name without its extension.
+func fileStem(name string) string {
+	base := path.Base(filepath.ToSlash(name))
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+func writePlaylistFile(w http.ResponseWriter, format playlistFormat, title string, items []playlist.Item) {
+	var buf bytes.Buffer
+	if err := format.write(&buf, title, items); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to write playlist: %v", err),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// GET /api/playlists/{id}.m3u8 (or .m3u, .xspf)
+// The playlist as a file for VLC, car stereos and the like: absolute stream
+// URLs with durations and titles. Missing entries are left out.
+func (s *Server) handlePlaylistExport(w http.ResponseWriter, r *http.Request, id string, format playlistFormat) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	p, err := s.playlists.Get(id)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	base := baseURL(r)
+	items := []playlist.Item{}
+	for _, e := range s.resolvePlaylist(p) {
+		if e.File != nil {
+			items = append(items, playlistItem(base, *e.File))
+		}
+	}
+	writePlaylistFile(w, format, p.Name, items)
+}
+
+// GET /api/files.m3u8 (or .m3u, .xspf)
+// Every file GET /api/files would list for the same query (dir and the
+// filter parameters), as a playlist file.
+func (s *Server) handleFilesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_, format, _ := splitPlaylistFormat(r.URL.Path)
+
+	query := r.URL.Query()
+	filter, err := parseFileFilter(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	var files []FileInfo
+	title := "ytdl2"
+	if query.Has("dir") {
+		abs, rel, err := s.resolveDir(query.Get("dir"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid folder",
+			})
+			return
+		}
+		if files, _, err = s.listDir(abs, rel); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Folder not found",
+			})
+			return
+		}
+		if rel != "" {
+			title = rel
+		}
+	} else if files, err = s.listAllFiles(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to list files: %v", err),
+		})
+		return
+	}
+
+	base := baseURL(r)
+	items := []playlist.Item{}
+	for _, fi := range filter.apply(files) {
+		items = append(items, playlistItem(base, fi))
+	}
+	writePlaylistFile(w, format, title, items)
+}
+
+// POST /api/playlists/import?name=...
+// Body: an M3U/M3U8 or XSPF file
+// Response: 201 with the new playlist plus "unmatched": [string], the entries
+// no library file was found for.
+// Entries are matched to library files by path first — our own stream URLs,
+// paths relative to the download directory, or absolute paths from another
+// machine ending in a library path — then by title (tagged or file name).
+// The playlist is named by ?name=, else the file's own title.
+func (s *Server) handlePlaylistImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPlaylistImport))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	title, items, err := playlist.Parse(data)
+	if err == nil && len(items) == 0 {
+		err = fmt.Errorf("playlist has no entries")
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = title
+	}
+	if name == "" {
+		name = "Imported playlist"
+	}
+
+	files, err := s.listAllFiles()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to list files: %v", err),
+		})
+		return
+	}
+	m := newPlaylistMatcher(files)
+	entries := []library.PlaylistEntry{}
+	unmatched := []string{}
+	for _, it := range items {
+		match, ok := m.match(it)
+		if !ok {
+			label := it.Location
+			if label == "" {
+				label = it.DisplayTitle()
+			}
+			unmatched = append(unmatched, label)
+			continue
+		}
+		t, _ := s.library.Get(match)
+		entries = append(entries, library.PlaylistEntry{Name: match, Fingerprint: t.Fingerprint})
+	}
+
+	p, err := s.playlists.Create(name, entries)
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	log.Printf("Imported playlist %s (%q): %d entries, %d unmatched", p.ID, p.Name, len(entries), len(unmatched))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		library.Playlist
+		Unmatched []string `json:"unmatched"`
+	}{p, unmatched})
+}
+
+// playlistMatcher finds the library file an imported playlist entry means.
+type playlistMatcher struct {
+	names  map[string]bool   // relative path with forward slashes
+	titles map[string]string // lowercased title or file stem -> name
+}
+
+func newPlaylistMatcher(files []FileInfo) *playlistMatcher {
+	m := &playlistMatcher{names: make(map[string]bool), titles: make(map[string]string)}
+	for _, fi := range files {
+		name := filepath.ToSlash(fi.Name)
+		m.names[name] = true
+		// The first file wins a shared title, so the match is stable.
+		for _, title := range []string{fi.Meta.Title, fileStem(name)} {
+			key := strings.ToLower(strings.TrimSpace(title))
+			if _, taken := m.titles[key]; key != "" && !taken {
+				m.titles[key] = name
+			}
+		}
+		if fi.Meta.Artist != "" && fi.Meta.Title != "" {
+			key := strings.ToLower(fi.Meta.Artist + " - " + fi.Meta.Title)
+			if _, taken := m.titles[key]; !taken {
+				m.titles[key] = name
+			}
+		}
+	}
+	return m
+}
+
+func (m *playlistMatcher) match(it playlist.Item) (string, bool) {
+	if p := locationPath(it.Location); p != "" {
+		// The longest trailing run of path segments naming a library file.
+		segments := strings.Split(strings.Trim(p, "/"), "/")
+		for i := range segments {
+			if name := strings.Join(segments[i:], "/"); m.names[name] {
+				return filepath.FromSlash(name), true
+			}
+		}
+	}
+	for _, title := range []string{it.DisplayTitle(), it.Title, fileStem(locationPath(it.Location))} {
+		if name, ok := m.titles[strings.ToLower(strings.TrimSpace(title))]; ok && title != "" {
+			return filepath.FromSlash(name), true
+		}
+	}
+	return "", false
+}
+
+// locationPath turns a playlist location — a URL (ours or anyone's), a file
+// URL, or a Unix or Windows path — into a slash-separated path.
+func locationPath(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		p := u.Path
+		if _, rest, ok := strings.Cut(p, "/api/files/"); ok {
+			p = rest
+		}
+		return p
+	}
+	return strings.ReplaceAll(location, `\`, "/")
+}
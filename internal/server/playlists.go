@@ -0,0 +1,400 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// playlistSummary is a playlist as listed, without its entries.
+type playlistSummary struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// playlistEntryInfo is an entry resolved against the download directory.
+type playlistEntryInfo struct {
+	Name    string    `json:"name"`
+	Missing bool      `json:"missing,omitempty"` // the file is gone
+	File    *FileInfo `json:"file,omitempty"`
+}
+
+// GET /api/playlists
+// Response: {"playlists": [{"id": string, "name": string, "count": int,
+// "created_at": string, "updated_at": string}]}
+//
+// POST /api/playlists
+// Body: {"name": string, "files"?: [string]}
+// Response: 201 with the playlist
+func (s *Server) handlePlaylists(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		summaries := []playlistSummary{}
+		for _, p := range s.playlists.List() {
+			summaries = append(summaries, playlistSummary{
+				ID:        p.ID,
+				Name:      p.Name,
+				Count:     len(p.Entries),
+				CreatedAt: p.CreatedAt,
+				UpdatedAt: p.UpdatedAt,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"playlists": summaries,
+		})
+
+	case http.MethodPost:
+		var body struct {
+			Name  string   `json:"name"`
+			Files []string `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		entries, status, err := s.playlistEntries(body.Files)
+		if err != nil {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+		p, err := s.playlists.Create(body.Name, entries)
+		if err != nil {
+			writePlaylistError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// handlePlaylist handles one playlist
+// GET /api/playlists/{id} - The playlist with its entries resolved to files
+// PATCH /api/playlists/{id} - Rename, body {"name": string}
+// DELETE /api/playlists/{id} - Delete the playlist (not its files)
+// GET /api/playlists/{id}.m3u8 (.m3u, .xspf) - Export, see handlePlaylistExport
+// POST /api/playlists/{id}/entries - Add files, body {"files": [string], "position"?: int}
+// PUT /api/playlists/{id}/entries - Reorder, body {"order": [int]} listing every current index once
+// DELETE /api/playlists/{id}/entries/{index} - Remove one entry
+// DELETE /api/playlists/{id}/entries?missing=true - Remove every entry whose file is gone
+// GET responds {"id", "name", "created_at", "updated_at", "entries": [{"name": string,
+// "missing"?: bool, "file"?: {...}}]}, where file is as in GET /api/files; the
+// others respond with the updated playlist. Entries follow files moved or
+// deleted through the API; files moved outside it are found again by content
+// fingerprint (and re-pointed for good by the next reconcile), and files that
+// are simply gone are flagged missing.
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/playlists/"), "/")
+
+	switch {
+	case sub == "entries":
+		s.handlePlaylistEntries(w, r, id)
+		return
+	case strings.HasPrefix(sub, "entries/"):
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Method not allowed",
+			})
+			return
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(sub, "entries/"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Invalid entry index",
+			})
+			return
+		}
+		p, err := s.playlists.Update(id, func(p *library.Playlist) error {
+			if index < 0 || index >= len(p.Entries) {
+				return fmt.Errorf("%w: no entry %d", library.ErrInvalidPlaylist, index)
+			}
+			p.Entries = slices.Delete(p.Entries, index, index+1)
+			return nil
+		})
+		writePlaylistResult(w, p, err)
+		return
+	case sub != "":
+		http.NotFound(w, r)
+		return
+	}
+	if id, format, ok := splitPlaylistFormat(id); ok {
+		s.handlePlaylistExport(w, r, id, format)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := s.playlists.Get(id)
+		if err != nil {
+			writePlaylistError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         p.ID,
+			"name":       p.Name,
+			"created_at": p.CreatedAt,
+			"updated_at": p.UpdatedAt,
+			"entries":    s.resolvePlaylist(p),
+		})
+
+	case http.MethodPatch:
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		p, err := s.playlists.Update(id, func(p *library.Playlist) error {
+			p.Name = body.Name
+			return nil
+		})
+		writePlaylistResult(w, p, err)
+
+	case http.MethodDelete:
+		if err := s.playlists.Delete(id); err != nil {
+			writePlaylistError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "ok",
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+func (s *Server) handlePlaylistEntries(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Files    []string `json:"files"`
+			Position *int     `json:"position"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		entries, status, err := s.playlistEntries(body.Files)
+		if err == nil && len(entries) == 0 {
+			status, err = http.StatusBadRequest, errors.New("files is required")
+		}
+		if err != nil {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+		p, err := s.playlists.Update(id, func(p *library.Playlist) error {
+			position := len(p.Entries)
+			if body.Position != nil && *body.Position >= 0 && *body.Position < position {
+				position = *body.Position
+			}
+			p.Entries = slices.Insert(p.Entries, position, entries...)
+			return nil
+		})
+		writePlaylistResult(w, p, err)
+
+	case http.MethodPut:
+		var body struct {
+			Order []int `json:"order"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		p, err := s.playlists.Update(id, func(p *library.Playlist) error {
+			if len(body.Order) != len(p.Entries) {
+				return fmt.Errorf("%w: order must list all %d entries", library.ErrInvalidPlaylist, len(p.Entries))
+			}
+			seen := make([]bool, len(p.Entries))
+			entries := make([]library.PlaylistEntry, 0, len(p.Entries))
+			for _, i := range body.Order {
+				if i < 0 || i >= len(p.Entries) || seen[i] {
+					return fmt.Errorf("%w: order must list each index 0-%d once", library.ErrInvalidPlaylist, len(p.Entries)-1)
+				}
+				seen[i] = true
+				entries = append(entries, p.Entries[i])
+			}
+			p.Entries = entries
+			return nil
+		})
+		writePlaylistResult(w, p, err)
+
+	case http.MethodDelete:
+		if r.URL.Query().Get("missing") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Use DELETE /api/playlists/{id}/entries/{index}, or ?missing=true to drop missing files",
+			})
+			return
+		}
+		// Checked under the playlist's lock, so entries added, moved or
+		// removed meanwhile can't shift which ones are dropped. Entries whose
+		// file moved are re-pointed rather than dropped.
+		locate := s.entryLocator()
+		p, err := s.playlists.Update(id, func(p *library.Playlist) error {
+			kept := []library.PlaylistEntry{}
+			for _, e := range p.Entries {
+				if name, _, ok := locate(e); ok {
+					e.Name = name
+					kept = append(kept, e)
+				}
+			}
+			p.Entries = kept
+			return nil
+		})
+		writePlaylistResult(w, p, err)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// playlistEntries checks that every file exists and makes entries for them.
+func (s *Server) playlistEntries(files []string) ([]library.PlaylistEntry, int, error) {
+	entries := make([]library.PlaylistEntry, 0, len(files))
+	for _, filename := range files {
+		name, status, err := s.libraryFile(filename)
+		if err != nil {
+			return nil, status, fmt.Errorf("%s: %v", filename, err)
+		}
+		t, _ := s.library.Get(name)
+		entries = append(entries, library.PlaylistEntry{Name: name, Fingerprint: t.Fingerprint})
+	}
+	return entries, http.StatusOK, nil
+}
+
+// entryLocator returns a function finding a playlist entry's file: where it
+// was added, or else a library file with the same content fingerprint (moved
+// outside the API). The library is loaded on the first miss.
+func (s *Server) entryLocator() func(e library.PlaylistEntry) (string, os.FileInfo, bool) {
+	var tracks map[string]library.Track
+	return func(e library.PlaylistEntry) (string, os.FileInfo, bool) {
+		info, err := os.Stat(filepath.Join(s.DownloadDirectory, e.Name))
+		if err == nil && !info.IsDir() {
+			return e.Name, info, true
+		}
+		if e.Fingerprint == "" {
+			return "", nil, false
+		}
+		if tracks == nil {
+			tracks = s.library.All()
+		}
+		for candidate, t := range tracks {
+			if t.Fingerprint != e.Fingerprint {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(s.DownloadDirectory, candidate)); err == nil && !info.IsDir() {
+				return candidate, info, true
+			}
+		}
+		return "", nil, false
+	}
+}
+
+// resolvePlaylist looks up each entry's file, following files moved outside
+// the API by fingerprint, and flags entries whose file is gone as missing.
+// It only reads; reconcile saves the moves (see repairPlaylists).
+func (s *Server) resolvePlaylist(p library.Playlist) []playlistEntryInfo {
+	locate := s.entryLocator()
+	entries := make([]playlistEntryInfo, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		name, info, ok := locate(e)
+		if !ok {
+			entries = append(entries, playlistEntryInfo{Name: e.Name, Missing: true})
+			continue
+		}
+		fi := s.fileInfo(name, info)
+		entries = append(entries, playlistEntryInfo{Name: name, File: &fi})
+	}
+	return entries
+}
+
+// repairPlaylists re-points entries whose file moved outside the API at the
+// library file with the same content fingerprint.
+func (s *Server) repairPlaylists() {
+	locate := s.entryLocator()
+	err := s.playlists.Repair(func(e library.PlaylistEntry) string {
+		if name, _, ok := locate(e); ok && name != e.Name {
+			return name
+		}
+		return ""
+	})
+	if err != nil {
+		log.Printf("Failed to repair playlists: %v", err)
+	}
+}
+
+func writePlaylistResult(w http.ResponseWriter, p library.Playlist, err error) {
+	if err != nil {
+		writePlaylistError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
+
+func writePlaylistError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, library.ErrPlaylistNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, library.ErrInvalidPlaylist):
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
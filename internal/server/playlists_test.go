@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+type playlistResp struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Entries []struct {
+		Name    string    `json:"name"`
+		Missing bool      `json:"missing"`
+		File    *FileInfo `json:"file"`
+	} `json:"entries"`
+}
+
+func TestPlaylistCRUDAndOrdering(t *testing.T) {
+	s, dir := newTestServer(t)
+	for _, name := range []string{"a.mp3", "b.mp3"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("fake "+name), 0o644)
+	}
+
+	rec := do(t, s, http.MethodPost, "/api/playlists", `{"name":"Friday mix","files":["song.mp3","a.mp3"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	var p library.Playlist
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	base := "/api/playlists/" + p.ID
+
+	steps := []struct {
+		method, target, body string
+		want                 []string
+	}{
+		{http.MethodPost, base + "/entries", `{"files":["b.mp3"],"position":0}`, []string{"b.mp3", "song.mp3", "a.mp3"}},
+		{http.MethodPost, base + "/entries", `{"files":["song.mp3"]}`, []string{"b.mp3", "song.mp3", "a.mp3", "song.mp3"}},
+		{http.MethodPut, base + "/entries", `{"order":[2,0,3,1]}`, []string{"a.mp3", "b.mp3", "song.mp3", "song.mp3"}},
+		{http.MethodDelete, base + "/entries/3", "", []string{"a.mp3", "b.mp3", "song.mp3"}},
+	}
+	for _, step := range steps {
+		rec := do(t, s, step.method, step.target, step.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d: %s", step.method, step.target, rec.Code, rec.Body)
+		}
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		var got []string
+		for _, e := range p.Entries {
+			got = append(got, e.Name)
+		}
+		if !slices.Equal(got, step.want) {
+			t.Fatalf("%s %s: entries = %v, want %v", step.method, step.target, got, step.want)
+		}
+	}
+
+	for _, c := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodPost, "/api/playlists", `{"name":"  "}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/playlists", `{"name":"x","files":["nope.mp3"]}`, http.StatusNotFound},
+		{http.MethodPut, base + "/entries", `{"order":[0,0,1]}`, http.StatusBadRequest},
+		{http.MethodPut, base + "/entries", `{"order":[0,1]}`, http.StatusBadRequest},
+		{http.MethodDelete, base + "/entries/9", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/playlists/p-none", "", http.StatusNotFound},
+	} {
+		if rec := do(t, s, c.method, c.target, c.body); rec.Code != c.want {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, rec.Code, c.want)
+		}
+	}
+
+	if rec := do(t, s, http.MethodPatch, base, `{"name":"Saturday mix"}`); rec.Code != http.StatusOK {
+		t.Fatalf("rename status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// Persisted across restarts.
+	s = NewServer(dir, dir, 360)
+	var list struct {
+		Playlists []playlistSummary `json:"playlists"`
+	}
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/playlists", "").Body.Bytes(), &list)
+	if len(list.Playlists) != 1 || list.Playlists[0].Name != "Saturday mix" || list.Playlists[0].Count != 3 {
+		t.Fatalf("playlists = %+v", list.Playlists)
+	}
+
+	if rec := do(t, s, http.MethodDelete, base, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodGet, base, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted playlist status = %d", rec.Code)
+	}
+}
+
+func TestPlaylistFollowsMovedAndDeletedFiles(t *testing.T) {
+	s, dir := newTestServer(t)
+	for _, name := range []string{"a.mp3", "b.mp3", "c.mp3"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("fake "+name), 0o644)
+	}
+	fp, err := library.Fingerprint(filepath.Join(dir, "c.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.library.Set("c.mp3", library.Track{Category: library.CategoryMusic, Size: int64(len("fake c.mp3")), Fingerprint: fp})
+
+	rec := do(t, s, http.MethodPost, "/api/playlists", `{"name":"mix","files":["song.mp3","a.mp3","b.mp3","c.mp3"]}`)
+	var p library.Playlist
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	base := "/api/playlists/" + p.ID
+
+	// Through the API: moved entries follow, deleted ones are dropped.
+	if rec := do(t, s, http.MethodPost, "/api/files/a.mp3/move", `{"to":"Show/a.mp3"}`); rec.Code != http.StatusOK {
+		t.Fatalf("move status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/files/song.mp3", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d: %s", rec.Code, rec.Body)
+	}
+	// Outside it: a fingerprinted file is found again, others are flagged.
+	os.Rename(filepath.Join(dir, "c.mp3"), filepath.Join(dir, "c2.mp3"))
+	s.library.Rename("c.mp3", "c2.mp3") // as a rescan would
+	os.Remove(filepath.Join(dir, "b.mp3"))
+
+	var got playlistResp
+	json.Unmarshal(do(t, s, http.MethodGet, base, "").Body.Bytes(), &got)
+	if len(got.Entries) != 3 ||
+		got.Entries[0].Name != filepath.Join("Show", "a.mp3") || got.Entries[0].File == nil ||
+		got.Entries[1].Name != "b.mp3" || !got.Entries[1].Missing ||
+		got.Entries[2].Name != "c2.mp3" || got.Entries[2].File == nil {
+		t.Fatalf("entries = %+v", got.Entries)
+	}
+	// Reading doesn't save the move; reconciling does.
+	if stored, _ := s.playlists.Get(p.ID); stored.Entries[2].Name != "c.mp3" {
+		t.Fatalf("GET re-pointed a stored entry: %+v", stored.Entries)
+	}
+	if _, err := s.reconcileLibrary(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := s.playlists.Get(p.ID); stored.Entries[2].Name != "c2.mp3" {
+		t.Fatalf("reconcile didn't re-point the moved entry: %+v", stored.Entries)
+	}
+
+	rec = do(t, s, http.MethodDelete, base+"/entries?missing=true", "")
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	if rec.Code != http.StatusOK || len(p.Entries) != 2 || p.Entries[1].Name != "c2.mp3" {
+		t.Fatalf("drop missing = %d: %+v", rec.Code, p.Entries)
+	}
+}
+
+func TestPlaylistExportAndImport(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.MkdirAll(filepath.Join(dir, "Talks"), 0o755)
+	os.WriteFile(filepath.Join(dir, "Talks", "keynote 1.mp3"), []byte("fake talk"), 0o644)
+	s.library.Set("song.mp3", library.Track{Category: library.CategoryMusic, Duration: 200.4, Meta: library.Metadata{Title: "Tune", Artist: "Band"}})
+	s.library.Set("Talks/keynote 1.mp3", library.Track{Category: library.CategoryPodcast, Duration: 3600})
+
+	rec := do(t, s, http.MethodPost, "/api/playlists", `{"name":"Mix","files":["Talks/keynote 1.mp3","song.mp3"]}`)
+	var p library.Playlist
+	json.Unmarshal(rec.Body.Bytes(), &p)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/playlists/"+p.ID+".m3u8", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "music.example")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	want := "#EXTM3U\n#PLAYLIST:Mix\n" +
+		"#EXTINF:3600,keynote 1\nhttps://music.example/api/files/Talks/keynote%201.mp3\n" +
+		"#EXTINF:200,Band - Tune\nhttps://music.example/api/files/song.mp3\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("m3u8 = %d:\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/files.xspf?dir=Talks", "")
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(ct, "application/xspf+xml") {
+		t.Fatalf("files.xspf = %d %s", rec.Code, ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "<title>keynote 1</title>") || strings.Contains(body, "song.mp3") {
+		t.Fatalf("files.xspf should list only the folder:\n%s", body)
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files.m3u8?status=bogus", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad filter = %d, want 400", rec.Code)
+	}
+
+	// By our own URL, by a foreign absolute path, by title; one miss.
+	upload := "#EXTM3U\n" +
+		"#EXTINF:1,x\nhttp://other-host/api/files/song.mp3\n" +
+		"/home/me/Podcasts/Talks/keynote 1.mp3\n" +
+		"#EXTINF:200,Band - Tune\nD:\\Music\\renamed.mp3\n" +
+		"#EXTINF:5,Nobody - Nothing\nnothing.mp3\n"
+	rec = do(t, s, http.MethodPost, "/api/playlists/import?name=Car", upload)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("import = %d: %s", rec.Code, rec.Body)
+	}
+	var imported struct {
+		library.Playlist
+		Unmatched []string `json:"unmatched"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &imported)
+	var got []string
+	for _, e := range imported.Entries {
+		got = append(got, e.Name)
+	}
+	if imported.Name != "Car" || !slices.Equal(got, []string{"song.mp3", "Talks/keynote 1.mp3", "song.mp3"}) || !slices.Equal(imported.Unmatched, []string{"nothing.mp3"}) {
+		t.Fatalf("import = %+v", imported)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/playlists/import", "<not xspf"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad import = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// completedMargin is the most a reported position can be short of the end
+// and still count as finished, so outros and closing music can be skipped.
+const completedMargin = 30 // seconds
+
+// GET /api/files/{filename}/progress
+// Response: {"position": float64, "last_played"?: string, "completed"?: bool,
+// "plays"?: int, "skips"?: int}
+//
+// PUT /api/files/{filename}/progress
+// Body: {"position": float64, "completed"?: bool}
+// Response: the stored progress
+// Records where listening left off so another device can resume there. Players
+// may report every few seconds; saving is coalesced. last_played is set to now.
+// Without "completed", a position in the last 5% of the file (at most 30
+// seconds) marks it completed.
+//
+// DELETE /api/files/{filename}/progress
+// Forgets the position and completed flag, e.g. to listen again from the
+// start. Play counts are kept.
+func (s *Server) handleProgress(w http.ResponseWriter, r *http.Request, filename string) {
+	name, status, err := s.libraryFile(filename)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, _ := s.playback.Progress(name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(p)
+
+	case http.MethodPut:
+		var body struct {
+			Position  *float64 `json:"position"`
+			Completed *bool    `json:"completed"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		if body.Position == nil || *body.Position < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "position must be given in seconds (>= 0)",
+			})
+			return
+		}
+
+		track, _ := s.library.Get(name)
+		p, _ := s.playback.UpdateProgress(name, func(p *library.Progress) error {
+			p.Position = *body.Position
+			p.LastPlayed = time.Now().UTC()
+			if body.Completed != nil {
+				p.Completed = *body.Completed
+			} else if track.Duration > 0 {
+				p.Completed = p.Position >= max(track.Duration-completedMargin, track.Duration*0.95)
+			} else {
+				p.Completed = false
+			}
+			return nil
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(p)
+
+	case http.MethodDelete:
+		s.playback.MarkPlayed([]string{name}, false)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Progress cleared",
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// POST /api/files/{filename}/plays
+// Body: {"event": "start" | "complete" | "skip", "position"?: float64}
+// Response: the file's progress, with "plays" and "skips" counts
+// Records a play event from a player. Every event sets last_played; complete
+// counts a play and marks the file played, skip counts a skip. position, if
+// given, is stored as the resume point (except on complete).
+func (s *Server) handlePlays(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	name, status, err := s.libraryFile(filename)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var body struct {
+		Event    library.PlayEvent `json:"event"`
+		Position *float64          `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	if body.Position != nil && *body.Position < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "position must be >= 0",
+		})
+		return
+	}
+
+	p, err := s.playback.UpdateProgress(name, func(p *library.Progress) error {
+		if body.Position != nil {
+			p.Position = *body.Position
+		}
+		return p.Apply(body.Event, time.Now().UTC())
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
+
+// POST /api/library/played
+// Body: {"files": [string], "played": bool}
+// Response: {"files": int}
+// Marks files played or unplayed in bulk, clearing their resume positions.
+// Play counts are kept. Every file must exist, or nothing is changed.
+func (s *Server) handleMarkPlayed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		Files  []string `json:"files"`
+		Played *bool    `json:"played"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	if body.Played == nil || len(body.Files) == 0 || len(body.Files) > maxBulkFiles {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("played and 1-%d files are required", maxBulkFiles),
+		})
+		return
+	}
+
+	names := make([]string, 0, len(body.Files))
+	for _, filename := range body.Files {
+		name, status, err := s.libraryFile(filename)
+		if err != nil {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("%s: %v", filename, err),
+			})
+			return
+		}
+		names = append(names, name)
+	}
+	s.playback.MarkPlayed(names, *body.Played)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{
+		"files": len(names),
+	})
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestProgressSharedAndPersisted(t *testing.T) {
+	s, dir := newTestServer(t)
+	t.Cleanup(func() { s.Close() })
+	s.library.Set("song.mp3", library.Track{Category: library.CategoryPodcast, Duration: 5400})
+
+	rec := do(t, s, http.MethodPut, "/api/files/song.mp3/progress", `{"position":1234.5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put status = %d: %s", rec.Code, rec.Body)
+	}
+	var p library.Progress
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/files/song.mp3/progress", "").Body.Bytes(), &p)
+	if p.Position != 1234.5 || p.LastPlayed.IsZero() || p.Completed {
+		t.Fatalf("progress = %+v", p)
+	}
+
+	// Near the end counts as finished unless the player says otherwise.
+	json.Unmarshal(do(t, s, http.MethodPut, "/api/files/song.mp3/progress", `{"position":5380}`).Body.Bytes(), &p)
+	if !p.Completed {
+		t.Fatalf("position 5380/5400 not completed: %+v", p)
+	}
+	p = library.Progress{}
+	json.Unmarshal(do(t, s, http.MethodPut, "/api/files/song.mp3/progress", `{"position":5380,"completed":false}`).Body.Bytes(), &p)
+	if p.Completed {
+		t.Fatalf("explicit completed=false ignored: %+v", p)
+	}
+
+	for body, want := range map[string]int{
+		`{}`:                 http.StatusBadRequest,
+		`{"position":-1}`:    http.StatusBadRequest,
+		`{"position":"abc"}`: http.StatusBadRequest,
+	} {
+		if rec := do(t, s, http.MethodPut, "/api/files/song.mp3/progress", body); rec.Code != want {
+			t.Errorf("PUT %s = %d, want %d", body, rec.Code, want)
+		}
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files/nope.mp3/progress", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing file status = %d", rec.Code)
+	}
+
+	// Listed with the file, and saved lazily.
+	var list struct {
+		Files []FileInfo `json:"files"`
+	}
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/files", "").Body.Bytes(), &list)
+	if len(list.Files) != 1 || list.Files[0].Progress == nil || list.Files[0].Progress.Position != 5380 {
+		t.Fatalf("files = %+v", list.Files)
+	}
+	playback := filepath.Join(dir, ".ytdl2", "playback.json")
+	if _, err := os.Stat(playback); !os.IsNotExist(err) {
+		t.Fatalf("playback saved before the flush delay (err=%v)", err)
+	}
+
+	// Follows the file when it moves, and survives a restart.
+	if rec := do(t, s, http.MethodPost, "/api/files/song.mp3/move", `{"to":"shows/ep.mp3"}`); rec.Code != http.StatusOK {
+		t.Fatalf("move status = %d: %s", rec.Code, rec.Body)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = NewServer(dir, dir, 360)
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/files/shows/ep.mp3/progress", "").Body.Bytes(), &p)
+	if p.Position != 5380 {
+		t.Fatalf("progress after move and restart = %+v", p)
+	}
+
+	if rec := do(t, s, http.MethodDelete, "/api/files/shows/ep.mp3/progress", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if p, _ := s.playback.Progress(filepath.Join("shows", "ep.mp3")); p.Position != 0 || p.Completed {
+		t.Fatalf("progress not cleared: %+v", p)
+	}
+	s.Close()
+}
+
+func TestPlayEventsAndStatusFilters(t *testing.T) {
+	s, dir := newTestServer(t)
+	t.Cleanup(func() { s.Close() })
+	for _, name := range []string{"ep1.mp3", "ep2.mp3"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("fake audio"), 0o644)
+	}
+
+	events := []struct{ file, body string }{
+		{"song.mp3", `{"event":"start","position":0}`},
+		{"song.mp3", `{"event":"complete"}`},
+		{"song.mp3", `{"event":"start"}`},
+		{"song.mp3", `{"event":"complete"}`},
+		{"ep1.mp3", `{"event":"start"}`},
+		{"ep1.mp3", `{"event":"skip","position":95}`},
+	}
+	for _, e := range events {
+		if rec := do(t, s, http.MethodPost, "/api/files/"+e.file+"/plays", e.body); rec.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d: %s", e.file, e.body, rec.Code, rec.Body)
+		}
+	}
+	if rec := do(t, s, http.MethodPost, "/api/files/song.mp3/plays", `{"event":"pause"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown event status = %d", rec.Code)
+	}
+	if p, _ := s.playback.Progress("song.mp3"); p.Plays != 2 || !p.Completed || p.LastPlayed.IsZero() {
+		t.Fatalf("song progress = %+v", p)
+	}
+	if p, _ := s.playback.Progress("ep1.mp3"); p.Skips != 1 || p.Position != 95 || p.Status() != library.StatusInProgress {
+		t.Fatalf("ep1 progress = %+v", p)
+	}
+
+	list := func(query string) []string {
+		t.Helper()
+		rec := do(t, s, http.MethodGet, "/api/files?"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("?%s = %d: %s", query, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Files []FileInfo `json:"files"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		var names []string
+		for _, f := range resp.Files {
+			names = append(names, f.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	for query, want := range map[string][]string{
+		"status=played":               {"song.mp3"},
+		"status=unplayed,in_progress": {"ep1.mp3", "ep2.mp3"},
+		"min_plays=2":                 {"song.mp3"},
+		"min_plays=3":                 nil,
+	} {
+		if got := list(query); !slices.Equal(got, want) {
+			t.Errorf("?%s = %v, want %v", query, got, want)
+		}
+	}
+	if rec := do(t, s, http.MethodGet, "/api/files?status=heard", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad status filter = %d", rec.Code)
+	}
+
+	// Bulk marking clears positions and keeps counts.
+	if rec := do(t, s, http.MethodPost, "/api/library/played", `{"files":["ep1.mp3","ep2.mp3"],"played":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("mark played = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/library/played", `{"files":["song.mp3"],"played":false}`); rec.Code != http.StatusOK {
+		t.Fatalf("mark unplayed = %d: %s", rec.Code, rec.Body)
+	}
+	if got := list("status=played"); !slices.Equal(got, []string{"ep1.mp3", "ep2.mp3"}) {
+		t.Fatalf("played after marking = %v", got)
+	}
+	if p, _ := s.playback.Progress("song.mp3"); p.Plays != 2 || p.Status() != library.StatusUnplayed {
+		t.Fatalf("song after marking unplayed = %+v", p)
+	}
+	for _, body := range []string{`{"files":["ep1.mp3"]}`, `{"files":[],"played":true}`, `{"files":["nope.mp3"],"played":true}`} {
+		if rec := do(t, s, http.MethodPost, "/api/library/played", body); rec.Code == http.StatusOK {
+			t.Errorf("POST %s succeeded", body)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// reconcileLibrary runs a library reconcile pass and moves or drops
+// everything else we keep about the files it renamed or pruned to match (see
+// followRename), then re-points playlist entries at files moved outside the
+// API.
+func (s *Server) reconcileLibrary() (library.ReconcileReport, error) {
+	report, err := s.library.Reconcile(s.DownloadDirectory)
+	if err != nil {
+		return report, err
+	}
+	for _, r := range report.Renamed {
+		s.followRename(r.From, r.To)
+	}
+	s.repairPlaylists()
+	for _, name := range report.Pruned {
+		s.followDelete(name)
+	}
+	if len(report.Renamed) > 0 || len(report.Pruned) > 0 {
+		log.Printf("Library reconciled: %d renamed, %d pruned", len(report.Renamed), len(report.Pruned))
+	}
+	return report, nil
+}
+
+// POST /api/library/reconcile
+// Response: {"pruned": [string], "renamed": [{"from": string, "to": string}], "fingerprinted": int}
+// Drops metadata for files deleted outside the API and re-attaches metadata
+// of files renamed outside the API (matched by size + content fingerprint),
+// replacing an entry a scan only guessed for the new name.
+func (s *Server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	report, err := s.reconcileLibrary()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to reconcile library: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
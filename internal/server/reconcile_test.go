@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestReconcileRenamesAndPrunes(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.WriteFile(filepath.Join(dir, "gone.mp3"), []byte("soon deleted"), 0o644)
+	do(t, s, http.MethodPost, "/api/files/song.mp3/category", `{"category":"podcast"}`)
+	do(t, s, http.MethodPost, "/api/files/gone.mp3/category", `{"category":"music"}`)
+
+	// First pass records fingerprints for the manually categorised files.
+	rec := do(t, s, http.MethodPost, "/api/library/reconcile", "")
+	var report library.ReconcileReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != 200 || report.Fingerprinted != 2 {
+		t.Fatalf("first pass: status=%d report=%+v", rec.Code, report)
+	}
+
+	// Out-of-band changes: a rename over SMB and a deletion.
+	os.MkdirAll(filepath.Join(dir, "shows"), 0o755)
+	os.Rename(filepath.Join(dir, "song.mp3"), filepath.Join(dir, "shows", "renamed.mp3"))
+	os.Remove(filepath.Join(dir, "gone.mp3"))
+
+	rec = do(t, s, http.MethodPost, "/api/library/reconcile", "")
+	report = library.ReconcileReport{}
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if len(report.Renamed) != 1 || report.Renamed[0] != (library.Rename{From: "song.mp3", To: "shows/renamed.mp3"}) {
+		t.Fatalf("renamed = %+v", report.Renamed)
+	}
+	if len(report.Pruned) != 1 || report.Pruned[0] != "gone.mp3" {
+		t.Fatalf("pruned = %+v", report.Pruned)
+	}
+	if tr, ok := s.library.Get("shows/renamed.mp3"); !ok || tr.Category != library.CategoryPodcast || tr.Source != library.SourceManual {
+		t.Fatalf("re-attached entry = %+v %v", tr, ok)
+	}
+	if _, ok := s.library.Get("gone.mp3"); ok {
+		t.Fatal("orphan not pruned")
+	}
+}
+
+func TestReconcileReplacesGuessedEntry(t *testing.T) {
+	s, dir := newTestServer(t)
+	do(t, s, http.MethodPost, "/api/files/song.mp3/category", `{"category":"podcast"}`)
+	do(t, s, http.MethodPost, "/api/library/reconcile", "")
+	old, _ := s.library.Get("song.mp3")
+
+	// A scan saw the renamed file before reconcile did and guessed for it.
+	os.Rename(filepath.Join(dir, "song.mp3"), filepath.Join(dir, "renamed.mp3"))
+	s.library.Set("renamed.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceGuessed})
+
+	rec := do(t, s, http.MethodPost, "/api/library/reconcile", "")
+	var report library.ReconcileReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if len(report.Renamed) != 1 || report.Renamed[0] != (library.Rename{From: "song.mp3", To: "renamed.mp3"}) {
+		t.Fatalf("renamed = %+v", report.Renamed)
+	}
+	if tr, _ := s.library.Get("renamed.mp3"); tr.Source != library.SourceManual || tr.Category != library.CategoryPodcast || tr.GUID != old.GUID {
+		t.Fatalf("re-attached entry = %+v, want the old one", tr)
+	}
+}
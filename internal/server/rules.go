@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// GET /api/rules
+// Response: {"rules": [{"id": string, "name"?: string, "category": string,
+// "disabled"?: bool, "match": {...}}]} in evaluation order
+//
+// POST /api/rules
+// Body: {"name"?: string, "category": string, "match": {"min_seconds"?, "max_seconds"?,
+// "domain"?, "uploader"?, "title"?, "filename"?, "folder"?, "tag"?}, "position"?: int}
+// Response: 201 with the rule
+// Rules decide the guessed category of new tracks: the first enabled rule
+// whose conditions all hold wins, falling back to the duration threshold.
+// Use POST /api/library/reclassify to apply changed rules to existing tracks.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rules": s.rules.List(),
+		})
+
+	case http.MethodPost:
+		var body struct {
+			library.Rule
+			Position *int `json:"position"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		position := -1
+		if body.Position != nil {
+			position = *body.Position
+		}
+		rule, err := s.rules.Create(body.Rule, position)
+		if err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// PUT /api/rules/{id} - Replace a rule (same body as POST /api/rules)
+// DELETE /api/rules/{id} - Delete a rule
+// PUT /api/rules/order - Body: {"ids": [string]} listing every rule in the new order
+// POST /api/rules/preview - Body: a rule (need not be saved); reports what it matches
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/rules/")
+	switch {
+	case id == "order":
+		s.handleReorderRules(w, r)
+		return
+	case id == "preview":
+		s.handlePreviewRule(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var rule library.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		rule.ID = id
+		rule, err := s.rules.Replace(rule)
+		if err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodDelete:
+		if err := s.rules.Delete(id); err != nil {
+			writeRuleError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "ok",
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+func (s *Server) handleReorderRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	rules, err := s.rules.Reorder(body.IDs)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+// Response: {"count": int, "matches": [{"name": string, "category": string,
+// "source": string, "would_change": bool}]}
+// would_change marks guessed tracks the rule would move to another category
+// if it came first; manual categories are never changed by rules.
+func (s *Server) handlePreviewRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	var rule library.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+
+	tracks := s.library.All()
+	names, err := s.rules.Test(rule, tracks)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+
+	type match struct {
+		Name        string           `json:"name"`
+		Category    library.Category `json:"category"`
+		Source      library.Source   `json:"source"`
+		WouldChange bool             `json:"would_change"`
+	}
+	matches := make([]match, 0, len(names))
+	for _, name := range names {
+		t := tracks[name]
+		matches = append(matches, match{
+			Name:        name,
+			Category:    t.Category,
+			Source:      t.Source,
+			WouldChange: t.Source == library.SourceGuessed && t.Category != rule.Category,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":   len(matches),
+		"matches": matches,
+	})
+}
+
+// writeRuleError maps rule store errors to a status code.
+func writeRuleError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError // failed to save
+	switch {
+	case errors.Is(err, library.ErrInvalidRule):
+		status = http.StatusBadRequest
+	case errors.Is(err, library.ErrRuleNotFound):
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
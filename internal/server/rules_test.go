@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestRulesAPI(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.library.Set("Shows/news.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceGuessed, Duration: 240})
+	s.library.Set("Shows/kept.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceManual, Duration: 240})
+	s.library.Set("song.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceGuessed, Duration: 240})
+
+	body := `{"name":"shows are podcasts","category":"podcast","match":{"folder":"Shows"}}`
+	rec := do(t, s, http.MethodPost, "/api/rules/preview", body)
+	var preview struct {
+		Count   int `json:"count"`
+		Matches []struct {
+			Name        string `json:"name"`
+			WouldChange bool   `json:"would_change"`
+		} `json:"matches"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &preview)
+	if preview.Count != 2 || preview.Matches[0].Name != "Shows/kept.mp3" || preview.Matches[0].WouldChange || !preview.Matches[1].WouldChange {
+		t.Fatalf("preview = %s", rec.Body)
+	}
+	if rules := s.rules.List(); len(rules) != 0 {
+		t.Fatalf("preview saved a rule: %+v", rules)
+	}
+
+	rec = do(t, s, http.MethodPost, "/api/rules", body)
+	var rule library.Rule
+	json.Unmarshal(rec.Body.Bytes(), &rule)
+	if rec.Code != http.StatusCreated || rule.ID == "" {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/rules", `{"category":"podcast","match":{"title":"("}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad pattern status = %d", rec.Code)
+	}
+
+	// Existing guesses follow the rules once reclassified; manual ones don't.
+	do(t, s, http.MethodPost, "/api/library/reclassify", "")
+	if tr, _ := s.library.Get("Shows/news.mp3"); tr.Category != library.CategoryPodcast {
+		t.Fatalf("Shows/news.mp3 = %+v", tr)
+	}
+	if tr, _ := s.library.Get("Shows/kept.mp3"); tr.Category != library.CategoryMusic {
+		t.Fatalf("Shows/kept.mp3 = %+v", tr)
+	}
+
+	if rec := do(t, s, http.MethodPut, "/api/rules/order", `{"ids":["bogus"]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad order status = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/rules/"+rule.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/rules/"+rule.ID, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("second delete status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GET /api/library/scan
+// Response: {"running": bool, "pending": bool, "started_at"?: string,
+// "finished_at"?: string, "seen": int, "queued": int, "probed": int,
+// "failed": int, "eta_seconds"?: float64}
+// Progress of the running library scan, or the result of the last one.
+//
+// POST /api/library/scan
+// Body (optional): {"force": bool}
+// Response: 202 with the status as above
+// Queues a rescan of the whole download directory. Only new or changed files
+// are probed unless force is set. A request made while a scan is running is
+// folded into the single scan that follows it.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.scanner.Status())
+
+	case http.MethodPost:
+		var body struct {
+			Force bool `json:"force"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		s.scanner.ScanAll(body.Force)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(s.scanner.Status())
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
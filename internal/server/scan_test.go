@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestScanEndpoint(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec := do(t, s, http.MethodPost, "/api/library/scan", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// ffprobe isn't available in tests, so every file fails to probe.
+	var st library.ScanStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = do(t, s, http.MethodGet, "/api/library/scan", "")
+		st = library.ScanStatus{}
+		json.Unmarshal(rec.Body.Bytes(), &st)
+		if !st.Running && !st.Pending && !st.FinishedAt.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan did not finish: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.Seen == 0 || st.Probed+st.Failed != st.Queued {
+		t.Fatalf("status = %+v", st)
+	}
+
+	if rec := do(t, s, http.MethodPost, "/api/library/scan", `{"force":`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad body status = %d", rec.Code)
+	}
+}
@@ -2,18 +2,24 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/iwanhae/ytdl2/internal/art"
 	"github.com/iwanhae/ytdl2/internal/command"
+	"github.com/iwanhae/ytdl2/internal/fsutil"
 	"github.com/iwanhae/ytdl2/internal/library"
+	"github.com/iwanhae/ytdl2/internal/podcast"
+	"github.com/iwanhae/ytdl2/internal/waveform"
 )
 
 type CommandInfo struct {
@@ -30,7 +36,18 @@ type Server struct {
 
 	DownloadDirectory   string
 	library             *library.Store
-	categoryThreshold   float64 // seconds; >= this is guessed "podcast"
+	settings            *library.SettingsStore
+	categories          *library.CategoryStore
+	rules               *library.RuleStore
+	playback            *library.PlaybackStore
+	playlists           *library.PlaylistStore
+	subscriptions       *podcast.Store
+	syncer              *podcast.Syncer
+	ChapterSilence      library.SilenceOptions
+	waveforms           *waveform.Cache
+	artwork             *art.Store
+	fileLocks           fsutil.FileLocks // held while a file is retagged, moved or deleted
+	scanner             *library.Scanner
 	commands            map[string]*CommandInfo
 	commandsMu          sync.RWMutex
 	commandCounter      int
@@ -39,17 +56,44 @@ type Server struct {
 	commandsSubMu       sync.RWMutex
 }
 
+// NewServer returns a server whose library is kept in the JSON sidecar
+// (.ytdl2/library.json) under downloadDirectory. categoryThreshold is the
+// default until changed through the settings endpoint.
 func NewServer(downloadDirectory, staticDirectory string, categoryThreshold float64) *Server {
+	lib := library.Load(filepath.Join(downloadDirectory, ".ytdl2", "library.json"))
+	return NewServerWithLibrary(downloadDirectory, staticDirectory, categoryThreshold, lib)
+}
+
+// NewServerWithLibrary is NewServer with a caller-opened library store, e.g.
+// one using a different backend (see library.Open).
+func NewServerWithLibrary(downloadDirectory, staticDirectory string, categoryThreshold float64, lib *library.Store) *Server {
 	log.Printf("Initializing server with static directory: %s", staticDirectory)
 	mux := http.NewServeMux()
+	metaDir := filepath.Join(downloadDirectory, ".ytdl2")
+	categories := library.LoadCategories(filepath.Join(metaDir, "categories.json"))
 	s := &Server{
 		ServeMux:            mux,
 		DownloadDirectory:   downloadDirectory,
-		library:             library.Load(filepath.Join(downloadDirectory, ".ytdl2", "library.json")),
-		categoryThreshold:   categoryThreshold,
+		library:             lib,
+		settings:            library.LoadSettings(filepath.Join(metaDir, "settings.json"), library.Settings{CategoryThreshold: categoryThreshold}),
+		categories:          categories,
+		rules:               library.LoadRules(filepath.Join(metaDir, "rules.json"), categories),
+		playback:            library.LoadPlayback(filepath.Join(metaDir, "playback.json")),
+		playlists:           library.LoadPlaylists(filepath.Join(metaDir, "playlists.json")),
+		subscriptions:       podcast.Load(filepath.Join(metaDir, "subscriptions.json")),
+		ChapterSilence:      library.DefaultSilenceOptions,
+		waveforms:           waveform.NewCache(filepath.Join(metaDir, "waveforms")),
+		artwork:             art.NewStore(filepath.Join(metaDir, "art")),
 		commands:            make(map[string]*CommandInfo),
 		commandsSubscribers: make(map[chan string]bool),
 	}
+	s.scanner = library.NewScanner(lib, downloadDirectory, func() float64 { return s.settings.Get().CategoryThreshold })
+	s.scanner.Rules = s.rules
+	s.scanner.OnProbed = s.ensureArt
+	s.scanner.Speech = func() bool { return s.settings.Get().SpeechDetection }
+	s.syncer = podcast.NewSyncer(s.subscriptions, lib, downloadDirectory)
+	s.syncer.Remove = s.removeFile
+	s.syncer.Downloaded = func(name string) { s.scanner.ScanPaths([]string{name}) }
 	// API routes (must be registered before static file server)
 	s.HandleFunc("/api/yt-dlp", s.handleYtDlp)
 	s.HandleFunc("/api/commands", s.handleCommands)
@@ -57,6 +101,33 @@ func NewServer(downloadDirectory, staticDirectory string, categoryThreshold floa
 	s.HandleFunc("/api/commands/", s.handleCommandLogs)
 	s.HandleFunc("/api/files", s.handleFiles)
 	s.HandleFunc("/api/files/", s.handleFileOperation)
+	s.HandleFunc("/api/files.m3u8", s.handleFilesExport)
+	s.HandleFunc("/api/files.m3u", s.handleFilesExport)
+	s.HandleFunc("/api/files.xspf", s.handleFilesExport)
+	s.HandleFunc("/api/dirs", s.handleDirs)
+	s.HandleFunc("/api/dirs/", s.handleDirs)
+	s.HandleFunc("/api/categories", s.handleCategories)
+	s.HandleFunc("/api/categories/", s.handleCategory)
+	s.HandleFunc("/api/rules", s.handleRules)
+	s.HandleFunc("/api/rules/", s.handleRule)
+	s.HandleFunc("/api/playlists", s.handlePlaylists)
+	s.HandleFunc("/api/playlists/", s.handlePlaylist)
+	s.HandleFunc("/api/playlists/import", s.handlePlaylistImport)
+	s.HandleFunc("/api/subscriptions", s.handleSubscriptions)
+	s.HandleFunc("/api/subscriptions/", s.handleSubscription)
+	s.HandleFunc("/api/subscriptions/import", s.handleSubscriptionsImport)
+	s.HandleFunc("/api/subscriptions.opml", s.handleSubscriptionsExport)
+	s.HandleFunc("/api/tags", s.handleTags)
+	s.HandleFunc("/api/tags/", s.handleTag)
+	s.HandleFunc("/api/tags/bulk", s.handleBulkTags)
+	s.HandleFunc("/api/library/reconcile", s.handleReconcile)
+	s.HandleFunc("/api/library/scan", s.handleScan)
+	s.HandleFunc("/api/library/settings", s.handleSettings)
+	s.HandleFunc("/api/library/reclassify", s.handleReclassify)
+	s.HandleFunc("/api/library/played", s.handleMarkPlayed)
+	s.HandleFunc("/api/library/duplicates", s.handleDuplicates)
+	s.HandleFunc("/api/library/duplicates/resolve", s.handleResolveDuplicates)
+	s.HandleFunc("/feeds/", s.handleFeed)
 
 	// Serve static files for non-API routes
 	// SPA Handler: Serve index.html for any unknown route that isn't an API route
@@ -92,10 +163,24 @@ func NewServer(downloadDirectory, staticDirectory string, categoryThreshold floa
 	return s
 }
 
-// ScanLibrary classifies any untagged files (probing duration + guessing
-// category). Run on a goroutine at startup to migrate a pre-existing library.
+// Close saves state that is written lazily (playback positions). Call it
+// before exiting.
+func (s *Server) Close() error {
+	return s.playback.Close()
+}
+
+// ScanLibrary reconciles the store with the files on disk (pruning deleted
+// files, re-attaching renamed ones), then classifies any untagged files
+// (probing duration + guessing category) and extracts missing artwork. Run on
+// a goroutine at startup to migrate a pre-existing library.
 func (s *Server) ScanLibrary() {
-	go s.library.ScanAndProbe(s.DownloadDirectory, s.categoryThreshold)
+	go func() {
+		if _, err := s.reconcileLibrary(); err != nil {
+			log.Printf("Failed to reconcile library: %v", err)
+		}
+		<-s.scanner.ScanAll(false)
+		s.extractMissingArt()
+	}()
 }
 
 func (s *Server) nextCommandID() string {
@@ -105,45 +190,20 @@ func (s *Server) nextCommandID() string {
 	return fmt.Sprintf("cmd-%d", s.commandCounter)
 }
 
-// POST /api/yt-dlp
-// Body: {"url": string}
-// Response: ok
-// This endpoint will execute `yt-dlp` command with the given url and return "ok" if successful.
-// It will be executed in background and the response will be sent immediately.
-func (s *Server) handleYtDlp(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	var body struct {
-		URL string `json:"url"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("Error decoding body: %v", err)
-		w.Write([]byte(fmt.Sprintf("Error decoding body: %v", err)))
-		return
-	}
-	log.Printf("Downloading %s...", body.URL)
-
-	cmd := command.
-		New("yt-dlp", "-f", "bestvideo*+bestaudio/best", "--extract-audio", "--audio-format", "mp3", body.URL).
-		SetWorkingDirectory(s.DownloadDirectory)
-
+// runTracked starts cmd and registers it as a command (listed, streamed and
+// broadcast like downloads). label is what clients see in the URL column.
+// onExit, if non-nil, runs after the process exits but before the completion
+// broadcast, so follow-up work is visible to clients when they refresh.
+func (s *Server) runTracked(cmd *command.Command, label string, onExit func(exitCode int)) (string, error) {
 	if err := cmd.Execute(); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Error executing yt-dlp: %v", err)
-		w.Write([]byte(fmt.Sprintf("Error executing yt-dlp: %v", err)))
-		return
+		return "", err
 	}
 
 	// Register command
 	cmdID := s.nextCommandID()
 	cmdInfo := &CommandInfo{
 		ID:        cmdID,
-		URL:       body.URL,
+		URL:       label,
 		Status:    "running",
 		StartedAt: time.Now(),
 		Command:   cmd,
@@ -165,10 +225,8 @@ func (s *Server) handleYtDlp(w http.ResponseWriter, r *http.Request) {
 		cmd.Wait()
 		exitCode := cmd.ExitCode()
 
-		// Classify any newly-landed files before signalling completion, so the
-		// client refresh (triggered by the broadcast below) already sees them.
-		if exitCode == 0 {
-			s.library.ScanAndProbe(s.DownloadDirectory, s.categoryThreshold)
+		if onExit != nil {
+			onExit(exitCode)
 		}
 
 		s.commandsMu.Lock()
@@ -184,6 +242,55 @@ func (s *Server) handleYtDlp(w http.ResponseWriter, r *http.Request) {
 		s.broadcastCommandUpdate()
 	}()
 
+	return cmdID, nil
+}
+
+// scanAfterSuccess classifies any newly-landed files, and extracts their
+// artwork, once a command that writes into the download directory succeeds.
+// It waits for the scan, so they're ready when the completion broadcast goes
+// out; jobs finishing together share one scan.
+func (s *Server) scanAfterSuccess(exitCode int) {
+	if exitCode == 0 {
+		<-s.scanner.ScanAll(false)
+	}
+}
+
+// POST /api/yt-dlp
+// Body: {"url": string}
+// Response: ok
+// This endpoint will execute `yt-dlp` command with the given url and return "ok" if successful.
+// It will be executed in background and the response will be sent immediately.
+func (s *Server) handleYtDlp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("Error decoding body: %v", err)
+		w.Write([]byte(fmt.Sprintf("Error decoding body: %v", err)))
+		return
+	}
+	log.Printf("Downloading %s...", body.URL)
+
+	cmd := command.
+		New("yt-dlp", "-f", "bestvideo*+bestaudio/best", "--extract-audio", "--audio-format", "mp3",
+			"--embed-thumbnail", "--convert-thumbnails", "jpg", body.URL).
+		SetWorkingDirectory(s.DownloadDirectory)
+
+	cmdID, err := s.runTracked(cmd, body.URL, s.scanAfterSuccess)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error executing yt-dlp: %v", err)
+		w.Write([]byte(fmt.Sprintf("Error executing yt-dlp: %v", err)))
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{
 		"status": "ok",
@@ -295,17 +402,67 @@ type FileInfo struct {
 	ModTime  time.Time `json:"mod_time"`
 	Category string    `json:"category,omitempty"` // "music" | "podcast"
 	Duration float64   `json:"duration,omitempty"` // seconds
+	ArtURL   string    `json:"art_url,omitempty"`
+
+	Meta   library.Metadata `json:"meta,omitzero"`   // embedded title/artist/album tags
+	Format library.Format   `json:"format,omitzero"` // codec, bitrate, sample rate, channels
+	Speech library.Speech   `json:"speech,omitzero"` // speech/music score, if analyzed
+	Tags   []string         `json:"tags,omitempty"`  // free-form labels
+	Added  time.Time        `json:"added,omitzero"`  // when the library first saw it
+
+	Episode *library.Episode `json:"episode,omitempty"` // feed details, for subscription downloads
+
+	Progress   *library.Progress  `json:"progress,omitempty"` // where listening left off, play counts
+	PlayStatus library.PlayStatus `json:"play_status"`        // unplayed, in_progress or played
 }
 
-// GET /api/files
-// Response: {"files": [{"name": string, "size": int64, "mod_time": string}]}
-// Returns a list of all files in the download directory
+// GET /api/files[?dir=path][&tag_any=a,b][&tag_all=a,b][&tag_none=a,b][&status=s1,s2][&min_plays=n]
+// Response: {"files": [{"name": string, "size": int64, "mod_time": string, "category": string, "duration": float, "art_url": string, "meta": {...}, "format": {...}, "speech": {...}, "tags": [string], "added": string, "episode": {...}, "progress": {...}, "play_status": string}]}
+// Returns a list of all files in the download directory. With ?dir= (empty
+// for the root) only that folder's direct children are returned, plus its
+// subfolders as "dirs": [{"name": string, "mod_time": string}]. The tag
+// parameters keep only files carrying any / all / none of the listed tags,
+// status only files with one of the listed play statuses, and min_plays only
+// files played to the end at least that often.
 func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	query := r.URL.Query()
+	filter, err := parseFileFilter(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	if query.Has("dir") {
+		s.writeDirListing(w, query.Get("dir"), filter)
+		return
+	}
+
+	files, err := s.listAllFiles()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to list files: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": filter.apply(files),
+	})
+}
+
+// listAllFiles walks the whole download directory (flattened, dotfiles and
+// the .ytdl2 sidecar dir hidden).
+func (s *Server) listAllFiles() ([]FileInfo, error) {
 	var files []FileInfo
 
 	err := filepath.WalkDir(s.DownloadDirectory, func(path string, d fs.DirEntry, err error) error {
@@ -333,42 +490,53 @@ func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		fi := FileInfo{
-			Name:    relPath,
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-		}
-		// Enrich from the store (pure read — probing happens at completion time).
-		if t, ok := s.library.Get(relPath); ok {
-			fi.Category = string(t.Category)
-			fi.Duration = t.Duration
-		}
-
-		files = append(files, fi)
+		files = append(files, s.fileInfo(relPath, info))
 
 		return nil
 	})
+	return files, err
+}
 
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("Failed to list files: %v", err),
-		})
-		return
+// fileInfo builds the listing entry for relPath, enriched from the store
+// (pure read — probing happens at completion time).
+func (s *Server) fileInfo(relPath string, info fs.FileInfo) FileInfo {
+	fi := FileInfo{
+		Name:    relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"files": files,
-	})
+	if t, ok := s.library.Get(relPath); ok {
+		fi.Category = string(t.Category)
+		fi.Duration = t.Duration
+		fi.Meta = t.Meta
+		fi.Format = t.Format
+		fi.Speech = t.Speech
+		fi.Tags = t.Tags
+		fi.Added = t.Added
+		fi.Episode = t.Episode
+	}
+	p, ok := s.playback.Progress(relPath)
+	if ok {
+		fi.Progress = &p
+	}
+	fi.PlayStatus = p.Status()
+	fi.ArtURL = s.artURL(relPath, info.ModTime())
+	return fi
 }
 
 // handleFileOperation handles file download, deletion, and audio extraction
 // GET /api/files/{filename} - Download file
 // DELETE /api/files/{filename} - Delete file
 // POST /api/files/{filename}/extract-audio - Extract audio to MP3
-// POST /api/files/{filename}/category - Override music/podcast category
+// POST /api/files/{filename}/category - Override the guessed category
+// GET|PUT /api/files/{filename}/chapters - Read or replace the chapter list
+// POST /api/files/{filename}/chapters/detect - Detect chapters from silence
+// GET /api/files/{filename}/waveform - Peak overview for the player
+// GET /api/files/{filename}/art - Cover art thumbnail
+// PATCH /api/files/{filename}/tags - Rewrite embedded tags (and cover art)
+// POST /api/files/{filename}/move - Rename or move within the library
+// GET/PUT/DELETE /api/files/{filename}/progress - Listening position
+// POST /api/files/{filename}/plays - Record a play event
 func (s *Server) handleFileOperation(w http.ResponseWriter, r *http.Request) {
 	// Extract filename from path: /api/files/{filename}
 	path := strings.TrimPrefix(r.URL.Path, "/api/files/")
@@ -387,6 +555,62 @@ func (s *Server) handleFileOperation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check if this is a chapter detection request
+	if strings.HasSuffix(path, "/chapters/detect") {
+		filename := strings.TrimSuffix(path, "/chapters/detect")
+		s.handleDetectChapters(w, r, filename)
+		return
+	}
+
+	// Check if this is a chapter list/edit request
+	if strings.HasSuffix(path, "/chapters") {
+		filename := strings.TrimSuffix(path, "/chapters")
+		s.handleChapters(w, r, filename)
+		return
+	}
+
+	// Check if this is a waveform request
+	if strings.HasSuffix(path, "/waveform") {
+		filename := strings.TrimSuffix(path, "/waveform")
+		s.handleWaveform(w, r, filename)
+		return
+	}
+
+	// Check if this is an artwork request
+	if strings.HasSuffix(path, "/art") {
+		filename := strings.TrimSuffix(path, "/art")
+		s.handleArt(w, r, filename)
+		return
+	}
+
+	// Check if this is a tag edit request
+	if strings.HasSuffix(path, "/tags") {
+		filename := strings.TrimSuffix(path, "/tags")
+		s.handleEditTags(w, r, filename)
+		return
+	}
+
+	// Check if this is a move/rename request
+	if strings.HasSuffix(path, "/move") {
+		filename := strings.TrimSuffix(path, "/move")
+		s.handleMoveFile(w, r, filename)
+		return
+	}
+
+	// Check if this is a playback progress request
+	if strings.HasSuffix(path, "/progress") {
+		filename := strings.TrimSuffix(path, "/progress")
+		s.handleProgress(w, r, filename)
+		return
+	}
+
+	// Check if this is a play event
+	if strings.HasSuffix(path, "/plays") {
+		filename := strings.TrimSuffix(path, "/plays")
+		s.handlePlays(w, r, filename)
+		return
+	}
+
 	// Check if this is a set-category request
 	if strings.HasSuffix(path, "/category") {
 		filename := strings.TrimSuffix(path, "/category")
@@ -439,6 +663,17 @@ func (s *Server) handleFileOperation(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		name, _ := filepath.Rel(filepath.Clean(s.DownloadDirectory), filePath)
+		unlock, ok := s.lockFiles([]string{name})
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": errFileBusy,
+			})
+			return
+		}
+		defer unlock()
+
 		// Delete the file
 		if err := os.Remove(filePath); err != nil {
 			log.Printf("Failed to delete file %s: %v", filePath, err)
@@ -450,9 +685,7 @@ func (s *Server) handleFileOperation(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Drop any cached metadata for this file (best-effort).
-		if err := s.library.Delete(path); err != nil {
-			log.Printf("Failed to prune library entry for %s: %v", path, err)
-		}
+		s.deleteDerived(name)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -638,8 +871,17 @@ func (s *Server) safePath(filename string) (string, error) {
 	return clean, nil
 }
 
+// fileURL returns the API URL of a library file, escaping each path segment.
+func fileURL(name string) string {
+	segments := strings.Split(filepath.ToSlash(name), "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return "/api/files/" + strings.Join(segments, "/")
+}
+
 // POST /api/files/{filename}/category
-// Body: {"category": "music" | "podcast"}
+// Body: {"category": string} (any name from GET /api/categories)
 // Manually overrides a track's category (source becomes "manual", which the
 // auto-guesser never overwrites). Existing duration is preserved.
 func (s *Server) handleSetCategory(w http.ResponseWriter, r *http.Request, filename string) {
@@ -679,25 +921,30 @@ func (s *Server) handleSetCategory(w http.ResponseWriter, r *http.Request, filen
 		return
 	}
 
+	// Preserve any probed duration (and everything else on the track). The
+	// category is checked inside the batch so that deleting it can't slip in
+	// between (see handleCategory).
 	cat := library.Category(body.Category)
-	if !cat.Valid() {
+	var duration float64
+	err = s.library.Batch(func(tx *library.Tx) error {
+		if !s.categories.Valid(cat) {
+			return library.ErrCategoryNotFound
+		}
+		t, _ := tx.Get(filename)
+		t.Category = cat
+		t.Source = library.SourceManual
+		duration = t.Duration
+		tx.Put(filename, t)
+		return nil
+	})
+	if errors.Is(err, library.ErrCategoryNotFound) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "category must be \"music\" or \"podcast\"",
+			"error": fmt.Sprintf("unknown category %q", body.Category),
 		})
 		return
 	}
-
-	// Preserve any probed duration.
-	var duration float64
-	if t, ok := s.library.Get(filename); ok {
-		duration = t.Duration
-	}
-	if err := s.library.Set(filename, library.Track{
-		Category: cat,
-		Source:   library.SourceManual,
-		Duration: duration,
-	}); err != nil {
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": fmt.Sprintf("Failed to persist category: %v", err),
@@ -776,7 +1023,8 @@ func (s *Server) handleExtractAudio(w http.ResponseWriter, r *http.Request, file
 	cmd := command.
 		New("ffmpeg", "-i", sourceFilePath, "-vn", "-acodec", "libmp3lame", "-q:a", "2", mp3FilePath, "-y")
 
-	if err := cmd.Execute(); err != nil {
+	cmdID, err := s.runTracked(cmd, fmt.Sprintf("Extract audio: %s", filename), s.scanAfterSuccess)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("Error executing ffmpeg: %v", err)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -785,51 +1033,6 @@ func (s *Server) handleExtractAudio(w http.ResponseWriter, r *http.Request, file
 		return
 	}
 
-	// Register command
-	cmdID := s.nextCommandID()
-	cmdInfo := &CommandInfo{
-		ID:        cmdID,
-		URL:       fmt.Sprintf("Extract audio: %s", filename),
-		Status:    "running",
-		StartedAt: time.Now(),
-		Command:   cmd,
-	}
-
-	s.commandsMu.Lock()
-	s.commands[cmdID] = cmdInfo
-	s.commandsMu.Unlock()
-
-	// Broadcast new command
-	s.broadcastCommandUpdate()
-
-	// Monitor command completion
-	go func() {
-		for line := range cmd.StdoutChannel() {
-			fmt.Println(line)
-		}
-		// Wait for command to finish
-		cmd.Wait()
-		exitCode := cmd.ExitCode()
-
-		// Classify any newly-landed files before signalling completion, so the
-		// client refresh (triggered by the broadcast below) already sees them.
-		if exitCode == 0 {
-			s.library.ScanAndProbe(s.DownloadDirectory, s.categoryThreshold)
-		}
-
-		s.commandsMu.Lock()
-		if exitCode == 0 {
-			cmdInfo.Status = "completed"
-		} else {
-			cmdInfo.Status = "failed"
-		}
-		cmdInfo.ExitCode = exitCode
-		s.commandsMu.Unlock()
-
-		// Broadcast command completion
-		s.broadcastCommandUpdate()
-	}()
-
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{
 		"status": "ok",
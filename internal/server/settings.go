@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// GET /api/library/settings
+// Response: {"category_threshold": float64, "speech_detection": bool}
+//
+// PATCH /api/library/settings
+// Body: {"category_threshold"?: float64, "speech_detection"?: bool}
+// Response: the updated settings
+// Changes take effect for the next guesses and are saved under .ytdl2. Tracks
+// already guessed keep their category until POST /api/library/reclassify;
+// turning speech_detection on only analyzes newly scanned files, so follow it
+// with a forced POST /api/library/scan to cover the existing library.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.settings.Get())
+
+	case http.MethodPatch:
+		var body struct {
+			CategoryThreshold *float64 `json:"category_threshold"`
+			SpeechDetection   *bool    `json:"speech_detection"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		if body.CategoryThreshold != nil && *body.CategoryThreshold <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "category_threshold must be positive",
+			})
+			return
+		}
+
+		settings, err := s.settings.Update(func(st *library.Settings) error {
+			if body.CategoryThreshold != nil {
+				st.CategoryThreshold = *body.CategoryThreshold
+			}
+			if body.SpeechDetection != nil {
+				st.SpeechDetection = *body.SpeechDetection
+			}
+			return nil
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to save settings: %v", err),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(settings)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// POST /api/library/reclassify
+// Body (optional): {"dry_run"?: bool, "category_threshold"?: float64}
+// Response: {"dry_run": bool, "category_threshold": float64,
+// "changes": [{"name": string, "duration": float64, "from": string, "to": string}]}
+// Re-guesses the category of every track whose category was guessed, using
+// the current threshold; manually set categories are never touched. With
+// dry_run nothing is changed and category_threshold may be given to preview a
+// threshold before saving it.
+func (s *Server) handleReclassify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		DryRun            bool     `json:"dry_run"`
+		CategoryThreshold *float64 `json:"category_threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+
+	threshold := s.settings.Get().CategoryThreshold
+	if body.CategoryThreshold != nil {
+		if !body.DryRun {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "category_threshold is only for dry runs; change it with PATCH /api/library/settings",
+			})
+			return
+		}
+		if *body.CategoryThreshold <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "category_threshold must be positive",
+			})
+			return
+		}
+		threshold = *body.CategoryThreshold
+	}
+
+	changes, err := s.library.Reclassify(s.rules, threshold, body.DryRun)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to reclassify: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dry_run":            body.DryRun,
+		"category_threshold": threshold,
+		"changes":            changes,
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestThresholdAndReclassify(t *testing.T) {
+	s, dir := newTestServer(t)
+	s.library.Set("a.mp3", library.Track{Category: library.CategoryPodcast, Source: library.SourceGuessed, Duration: 400})
+	s.library.Set("b.mp3", library.Track{Category: library.CategoryPodcast, Source: library.SourceManual, Duration: 400})
+	s.library.Set("c.mp3", library.Track{Category: library.CategoryMusic, Source: library.SourceGuessed, Duration: 100})
+
+	if rec := do(t, s, http.MethodPatch, "/api/library/settings", `{"category_threshold":-1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative threshold status = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodPatch, "/api/library/settings", `{"category_threshold":500}`); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH status = %d: %s", rec.Code, rec.Body)
+	}
+	// Persisted: a fresh server over the same directory picks it up.
+	if got := NewServer(dir, dir, 360).settings.Get().CategoryThreshold; got != 500 {
+		t.Fatalf("reloaded threshold = %v", got)
+	}
+
+	type result struct {
+		DryRun  bool                       `json:"dry_run"`
+		Changes []library.Reclassification `json:"changes"`
+	}
+	var res result
+	rec := do(t, s, http.MethodPost, "/api/library/reclassify", `{"dry_run":true}`)
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	want := library.Reclassification{Name: "a.mp3", Duration: 400, From: library.CategoryPodcast, To: library.CategoryMusic}
+	if len(res.Changes) != 1 || res.Changes[0] != want {
+		t.Fatalf("dry run changes = %+v", res.Changes)
+	}
+	if tr, _ := s.library.Get("a.mp3"); tr.Category != library.CategoryPodcast {
+		t.Fatalf("dry run changed a.mp3: %+v", tr)
+	}
+
+	// Preview a different threshold without saving it.
+	res = result{}
+	rec = do(t, s, http.MethodPost, "/api/library/reclassify", `{"dry_run":true,"category_threshold":60}`)
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if len(res.Changes) != 1 || res.Changes[0].Name != "c.mp3" {
+		t.Fatalf("preview changes = %+v", res.Changes)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/library/reclassify", `{"category_threshold":60}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("threshold without dry_run status = %d", rec.Code)
+	}
+
+	do(t, s, http.MethodPost, "/api/library/reclassify", "")
+	if tr, _ := s.library.Get("a.mp3"); tr.Category != library.CategoryMusic || tr.Source != library.SourceGuessed {
+		t.Fatalf("a.mp3 = %+v", tr)
+	}
+	if tr, _ := s.library.Get("b.mp3"); tr.Category != library.CategoryPodcast {
+		t.Fatalf("manual b.mp3 was reclassified: %+v", tr)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/podcast"
+)
+
+// subscriptionSummary is a subscription as listed, without its episodes.
+type subscriptionSummary struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Folder      string    `json:"folder"`
+	KeepLatest  int       `json:"keep_latest"`
+	Downloaded  int       `json:"downloaded"` // episode files on disk
+	CreatedAt   time.Time `json:"created_at"`
+	LastChecked time.Time `json:"last_checked,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+func summarizeSubscription(sub podcast.Subscription) subscriptionSummary {
+	sum := subscriptionSummary{
+		ID:          sub.ID,
+		URL:         sub.URL,
+		Title:       sub.Title,
+		Folder:      sub.Folder,
+		KeepLatest:  sub.KeepLatest,
+		CreatedAt:   sub.CreatedAt,
+		LastChecked: sub.LastChecked,
+		LastError:   sub.LastError,
+	}
+	for _, e := range sub.Episodes {
+		if e.File != "" {
+			sum.Downloaded++
+		}
+	}
+	return sum
+}
+
+// RunSubscriptions checks every podcast subscription for new episodes each
+// interval, in the background.
+func (s *Server) RunSubscriptions(interval time.Duration) {
+	go s.syncer.Run(context.Background(), interval)
+}
+
+// removeFile deletes a library file and everything derived from it.
+func (s *Server) removeFile(name string) error {
+	if err := os.Remove(filepath.Join(s.DownloadDirectory, name)); err != nil {
+		return err
+	}
+	s.deleteDerived(name)
+	return nil
+}
+
+// subscribeRequest describes a feed to subscribe to. Only URL is required.
+type subscribeRequest struct {
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	Folder     string `json:"folder"`
+	KeepLatest *int   `json:"keep_latest"`
+}
+
+// subscribe fetches the feed (to check it and learn its title) and saves a
+// subscription to it. The first download happens with the next check.
+func (s *Server) subscribe(ctx context.Context, req subscribeRequest) (podcast.Subscription, error) {
+	req.URL = strings.TrimSpace(req.URL)
+	if _, ok := s.subscriptions.Find(req.URL); ok {
+		return podcast.Subscription{}, podcast.ErrSubscriptionExists
+	}
+	sub := podcast.Subscription{URL: req.URL, Title: req.Title, Folder: req.Folder, KeepLatest: podcast.DefaultKeepLatest}
+	if req.KeepLatest != nil {
+		sub.KeepLatest = *req.KeepLatest
+	}
+	if !strings.HasPrefix(sub.URL, "http://") && !strings.HasPrefix(sub.URL, "https://") {
+		return sub, fmt.Errorf("%w: url must be an http(s) URL", podcast.ErrInvalidSubscription)
+	}
+	ch, err := s.syncer.Fetch(ctx, sub.URL)
+	if err != nil {
+		return sub, fmt.Errorf("%w: %v", errFeedUnavailable, err)
+	}
+	if sub.Title == "" {
+		sub.Title = ch.Title
+	}
+	if sub.Folder == "" {
+		sub.Folder = podcast.DefaultFolder(sub.Title)
+	}
+	sub, err = s.subscriptions.Create(sub)
+	if err != nil {
+		return sub, err
+	}
+	s.syncer.Wake()
+	return sub, nil
+}
+
+// errFeedUnavailable is returned when a feed can't be fetched or parsed.
+var errFeedUnavailable = errors.New("failed to fetch feed")
+
+// GET /api/subscriptions
+// Response: {"subscriptions": [{"id": string, "url": string, "title": string,
+// "folder": string, "keep_latest": int, "downloaded": int, "created_at": string,
+// "last_checked"?: string, "last_error"?: string}]}
+//
+// POST /api/subscriptions
+// Body: {"url": string, "title"?: string, "folder"?: string, "keep_latest"?: int}
+// Response: 201 with the subscription
+// Subscribes to an RSS or Atom podcast feed. The title defaults to the feed's,
+// the folder to Podcasts/{title}, and keep_latest (0 keeps everything) to 5.
+// New episodes are downloaded shortly after and then on every check.
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		summaries := []subscriptionSummary{}
+		for _, sub := range s.subscriptions.List() {
+			summaries = append(summaries, summarizeSubscription(sub))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"subscriptions": summaries,
+		})
+
+	case http.MethodPost:
+		var body subscribeRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		sub, err := s.subscribe(r.Context(), body)
+		if err != nil {
+			writeSubscriptionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+// handleSubscription handles one subscription
+// GET /api/subscriptions/{id} - The subscription with its downloaded episodes
+// PATCH /api/subscriptions/{id} - Change it, body {"title"?: string, "folder"?: string, "keep_latest"?: int}
+// DELETE /api/subscriptions/{id} - Unsubscribe (downloaded files are kept)
+// POST /api/subscriptions/{id}/refresh - Check for new episodes now (409
+// while a check of any subscription is already running)
+// Episodes are {"guid", "title", "published", "file"}, newest first; file is
+// gone once the episode was removed. A lower keep_latest applies at the next
+// check; a new folder applies to later downloads.
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/")
+
+	switch {
+	case action == "refresh":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Method not allowed",
+			})
+			return
+		}
+		res, err := s.syncer.TrySync(r.Context(), id)
+		if err != nil {
+			if !errors.Is(err, podcast.ErrSubscriptionNotFound) && !errors.Is(err, podcast.ErrSyncInProgress) {
+				err = fmt.Errorf("%w: %v", errFeedUnavailable, err)
+			}
+			writeSubscriptionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+		return
+	case action != "":
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sub, err := s.subscriptions.Get(id)
+		writeSubscriptionResult(w, sub, err)
+
+	case http.MethodPatch:
+		var body struct {
+			Title      *string `json:"title"`
+			Folder     *string `json:"folder"`
+			KeepLatest *int    `json:"keep_latest"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid body: %v", err),
+			})
+			return
+		}
+		sub, err := s.subscriptions.Update(id, func(sub *podcast.Subscription) error {
+			if body.Title != nil {
+				sub.Title = *body.Title
+			}
+			if body.Folder != nil {
+				sub.Folder = *body.Folder
+			}
+			if body.KeepLatest != nil {
+				sub.KeepLatest = *body.KeepLatest
+			}
+			return nil
+		})
+		writeSubscriptionResult(w, sub, err)
+
+	case http.MethodDelete:
+		if err := s.subscriptions.Delete(id); err != nil {
+			writeSubscriptionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "ok",
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+	}
+}
+
+func writeSubscriptionResult(w http.ResponseWriter, sub podcast.Subscription, err error) {
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func writeSubscriptionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, podcast.ErrSubscriptionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, podcast.ErrSubscriptionExists), errors.Is(err, podcast.ErrSyncInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, podcast.ErrInvalidSubscription):
+		status = http.StatusBadRequest
+	case errors.Is(err, errFeedUnavailable):
+		status = http.StatusBadGateway
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/iwanhae/ytdl2/internal/podcast"
+)
+
+// maxOPMLImport bounds uploaded OPML files.
+const maxOPMLImport = 5 << 20
+
+// opmlImportWorkers is how many feeds an import fetches at once.
+const opmlImportWorkers = 4
+
+// GET /api/subscriptions.opml
+// Every subscription as an OPML 2.0 file, for moving to another podcast app.
+func (s *Server) handleSubscriptionsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	var buf bytes.Buffer
+	if err := podcast.WriteOPML(&buf, "ytdl2 subscriptions", s.subscriptions.List()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to write OPML: %v", err),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// opmlFailure is a feed an OPML import couldn't subscribe to.
+type opmlFailure struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+// POST /api/subscriptions/import?keep_latest=...
+// Body: an OPML file, as exported by most podcast apps
+// Response: {"created": [subscription], "skipped": [string], "failed": [{"url":
+// string, "title"?: string, "error": string}]}
+// Subscribes to every outline with an xmlUrl, folders included, as POST
+// /api/subscriptions would with the outline's title. Feeds already subscribed
+// to (or listed twice) are skipped; feeds that can't be fetched are reported.
+// keep_latest applies to every new subscription (default 5).
+func (s *Server) handleSubscriptionsImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+	var keepLatest *int
+	if v := r.URL.Query().Get("keep_latest"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "keep_latest must be a non-negative number",
+			})
+			return
+		}
+		keepLatest = &n
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOPMLImport))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	outlines, err := podcast.ParseOPML(data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Feeds are fetched a few at a time; results keep the file's order. A feed
+	// listed twice is subscribed to as its first outline has it.
+	subs := make([]podcast.Subscription, len(outlines))
+	errs := make([]error, len(outlines))
+	var todo []int
+	for i, o := range outlines {
+		if slices.ContainsFunc(outlines[:i], func(prev podcast.Outline) bool { return podcast.SameFeed(prev.XMLURL, o.XMLURL) }) {
+			errs[i] = podcast.ErrSubscriptionExists
+			continue
+		}
+		todo = append(todo, i)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opmlImportWorkers, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				o := outlines[i]
+				subs[i], errs[i] = s.subscribe(r.Context(), subscribeRequest{URL: o.XMLURL, Title: o.Title, KeepLatest: keepLatest})
+			}
+		}()
+	}
+	for _, i := range todo {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	created := []subscriptionSummary{}
+	skipped := []string{}
+	failed := []opmlFailure{}
+	for i, o := range outlines {
+		switch err := errs[i]; {
+		case err == nil:
+			created = append(created, summarizeSubscription(subs[i]))
+		case errors.Is(err, podcast.ErrSubscriptionExists):
+			skipped = append(skipped, o.XMLURL)
+		default:
+			failed = append(failed, opmlFailure{URL: o.XMLURL, Title: o.Title, Error: err.Error()})
+		}
+	}
+	log.Printf("Imported OPML: %d subscribed, %d skipped, %d failed", len(created), len(skipped), len(failed))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"created": created,
+		"skipped": skipped,
+		"failed":  failed,
+	})
+}
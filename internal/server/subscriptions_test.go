@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/podcast"
+)
+
+func newPodcastFeed(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Deep Dive</title>
+<item><title>Pilot</title><guid>ep-1</guid><pubDate>Tue, 05 Mar 2024 06:07:08 +0000</pubDate>
+<description>First notes</description><enclosure url="%s/ep1.mp3" length="9" type="audio/mpeg"/></item>
+</channel></rss>`, srv.URL)
+		case "/ep1.mp3":
+			fmt.Fprint(w, "fake ep 1")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSubscriptions(t *testing.T) {
+	s, _ := newTestServer(t)
+	feed := newPodcastFeed(t)
+
+	rec := do(t, s, http.MethodPost, "/api/subscriptions", `{"url":"`+feed.URL+`/feed.xml","keep_latest":2}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("subscribe = %d: %s", rec.Code, rec.Body)
+	}
+	var sub podcast.Subscription
+	json.Unmarshal(rec.Body.Bytes(), &sub)
+	if sub.Title != "Deep Dive" || sub.Folder != filepath.Join("Podcasts", "Deep Dive") || sub.KeepLatest != 2 {
+		t.Fatalf("subscription = %+v", sub)
+	}
+	for body, want := range map[string]int{
+		`{"url":"` + feed.URL + `/feed.xml"}`:    http.StatusConflict,
+		`{"url":"` + feed.URL + `/missing.xml"}`: http.StatusBadGateway,
+		`{"url":"ftp://example.com/feed"}`:       http.StatusBadRequest,
+	} {
+		if rec := do(t, s, http.MethodPost, "/api/subscriptions", body); rec.Code != want {
+			t.Errorf("POST %s = %d, want %d", body, rec.Code, want)
+		}
+	}
+
+	rec = do(t, s, http.MethodPost, "/api/subscriptions/"+sub.ID+"/refresh", "")
+	var res podcast.Result
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	name := filepath.Join("Podcasts", "Deep Dive", "2024-03-05 Pilot.mp3")
+	if rec.Code != http.StatusOK || len(res.Downloaded) != 1 || res.Downloaded[0] != name {
+		t.Fatalf("refresh = %d %+v", rec.Code, res)
+	}
+	var listing struct {
+		Files []FileInfo `json:"files"`
+	}
+	json.Unmarshal(do(t, s, http.MethodGet, "/api/files", "").Body.Bytes(), &listing)
+	i := slices.IndexFunc(listing.Files, func(fi FileInfo) bool { return fi.Name == name })
+	if i < 0 {
+		t.Fatalf("%s not listed: %+v", name, listing.Files)
+	}
+	if fi := listing.Files[i]; fi.Category != "podcast" || fi.Episode == nil || fi.Episode.Show != "Deep Dive" || fi.Episode.Notes != "First notes" {
+		t.Fatalf("file = %+v", fi)
+	}
+
+	// Deleting the file through the API keeps the episode from coming back.
+	if rec := do(t, s, http.MethodDelete, fileURL(name), ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete = %d", rec.Code)
+	}
+	rec = do(t, s, http.MethodGet, "/api/subscriptions/"+sub.ID, "")
+	json.Unmarshal(rec.Body.Bytes(), &sub)
+	if len(sub.Episodes) != 1 || sub.Episodes[0].File != "" {
+		t.Fatalf("episodes = %+v", sub.Episodes)
+	}
+	rec = do(t, s, http.MethodPost, "/api/subscriptions/"+sub.ID+"/refresh", "")
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if len(res.Downloaded) != 0 {
+		t.Fatalf("second refresh downloaded %v", res.Downloaded)
+	}
+
+	if rec := do(t, s, http.MethodPatch, "/api/subscriptions/"+sub.ID, `{"keep_latest":-1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad keep_latest = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/subscriptions/"+sub.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("unsubscribe = %d", rec.Code)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/subscriptions/"+sub.ID+"/refresh", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("refresh after unsubscribe = %d", rec.Code)
+	}
+}
+
+func TestSubscriptionsOPML(t *testing.T) {
+	s, _ := newTestServer(t)
+	feed := newPodcastFeed(t)
+	if rec := do(t, s, http.MethodPost, "/api/subscriptions", `{"url":"`+feed.URL+`/feed.xml"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("subscribe = %d: %s", rec.Code, rec.Body)
+	}
+
+	opml := `<?xml version="1.0"?><opml version="2.0"><head><title>Old app</title></head><body>
+<outline text="Shows">
+  <outline type="rss" text="Deep Dive" xmlUrl="` + feed.URL + `/feed.xml"/>
+  <outline type="rss" text="Renamed" xmlUrl="` + feed.URL + `/feed.xml?x=1"/>
+  <outline type="rss" text="Renamed again" xmlUrl="` + feed.URL + `/feed.xml?x=1"/>
+</outline>
+<outline type="rss" text="Gone" xmlUrl="` + feed.URL + `/missing.xml"/>
+</body></opml>`
+	rec := do(t, s, http.MethodPost, "/api/subscriptions/import?keep_latest=0", opml)
+	var res struct {
+		Created []subscriptionSummary `json:"created"`
+		Skipped []string              `json:"skipped"`
+		Failed  []opmlFailure         `json:"failed"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusOK || len(res.Created) != 1 || len(res.Skipped) != 2 || len(res.Failed) != 1 {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+	if c := res.Created[0]; c.Title != "Renamed" || c.KeepLatest != 0 {
+		t.Fatalf("created = %+v", c)
+	}
+	if res.Failed[0].URL != feed.URL+"/missing.xml" || res.Failed[0].Error == "" {
+		t.Fatalf("failed = %+v", res.Failed)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/subscriptions/import", "not opml"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("import garbage = %d", rec.Code)
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/subscriptions.opml", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/x-opml; charset=utf-8" {
+		t.Fatalf("export = %d %s", rec.Code, rec.Header())
+	}
+	outlines, err := podcast.ParseOPML(rec.Body.Bytes())
+	if err != nil || len(outlines) != 2 || outlines[0].Title != "Deep Dive" || outlines[1].XMLURL != feed.URL+"/feed.xml?x=1" {
+		t.Fatalf("exported = %+v, %v\n%s", outlines, err, rec.Body)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// maxBulkFiles bounds the file lists of bulk endpoints (POST /api/tags/bulk,
+// POST /api/library/played) so one request can't hold a store lock for long.
+const maxBulkFiles = 10000
+
+// GET /api/tags
+// Response: {"tags": [{"name": string, "count": int}]}
+// Lists every tag in use with how many files carry it, most used first.
+// Tags are free-form labels; unlike categories a file can have any number.
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tags": s.library.TagCounts(),
+	})
+}
+
+// handleTag handles one tag
+// PUT /api/tags/{tag}/files/{filename} - Tag a file
+// DELETE /api/tags/{tag}/files/{filename} - Untag a file
+// DELETE /api/tags/{tag} - Remove the tag from every file
+// Per-file responses are {"name": string, "tags": [string]} with the file's
+// resulting tags; removing a tag everywhere responds {"tag": string, "files": int}.
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/tags/")
+	tag, filename, perFile := strings.Cut(path, "/files/")
+	tags, err := library.NormalizeTags([]string{tag})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if !perFile {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Method not allowed",
+			})
+			return
+		}
+		var names []string
+		for name, t := range s.library.All() {
+			if slices.Contains(t.Tags, tags[0]) {
+				names = append(names, name)
+			}
+		}
+		if _, err := s.library.Retag(names, nil, tags); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Failed to persist tags: %v", err),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tag":   tags[0],
+			"files": len(names),
+		})
+		return
+	}
+
+	var add, remove []string
+	switch r.Method {
+	case http.MethodPut:
+		add = tags
+	case http.MethodDelete:
+		remove = tags
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	name, status, err := s.libraryFile(filename)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	result, err := s.library.Retag([]string{name}, add, remove)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to persist tags: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name": name,
+		"tags": nonNil(result[name]),
+	})
+}
+
+// POST /api/tags/bulk
+// Body: {"files": [string], "add"?: [string], "remove"?: [string]}
+// Response: {"files": {filename: [string]}} with each file's resulting tags
+// Adds and removes tags on many files at once. Every file must exist, or
+// nothing is changed.
+func (s *Server) handleBulkTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		Files  []string `json:"files"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	add, err := library.NormalizeTags(body.Add)
+	if err == nil {
+		body.Remove, err = library.NormalizeTags(body.Remove)
+	}
+	if err == nil && len(add) == 0 && len(body.Remove) == 0 {
+		err = errors.New("Nothing to change")
+	}
+	if err == nil && (len(body.Files) == 0 || len(body.Files) > maxBulkFiles) {
+		err = fmt.Errorf("files must list 1-%d files", maxBulkFiles)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	names := make([]string, 0, len(body.Files))
+	for _, filename := range body.Files {
+		name, status, err := s.libraryFile(filename)
+		if err != nil {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("%s: %v", filename, err),
+			})
+			return
+		}
+		names = append(names, name)
+	}
+
+	result, err := s.library.Retag(names, add, body.Remove)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to persist tags: %v", err),
+		})
+		return
+	}
+	for name, tags := range result {
+		result[name] = nonNil(tags)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": result,
+	})
+}
+
+// libraryFile resolves filename to its store key, or fails with the status to
+// respond with if it isn't a visible file in the download directory.
+func (s *Server) libraryFile(filename string) (string, int, error) {
+	path, err := s.safePath(filename)
+	if err != nil || hasHiddenSegment(filename) {
+		return "", http.StatusBadRequest, errors.New("Invalid filename")
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", http.StatusNotFound, errors.New("File not found")
+	}
+	name, err := filepath.Rel(s.DownloadDirectory, path)
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("Invalid filename")
+	}
+	return name, http.StatusOK, nil
+}
+
+// nonNil makes an empty list encode as [] rather than null.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestTagsAndFilters(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.MkdirAll(filepath.Join(dir, "Show"), 0o755)
+	os.WriteFile(filepath.Join(dir, "Show", "ep1.mp3"), []byte("fake audio"), 0o644)
+	os.WriteFile(filepath.Join(dir, "run.mp3"), []byte("fake audio"), 0o644)
+
+	rec := do(t, s, http.MethodPut, "/api/tags/Workout/files/song.mp3", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"name":"song.mp3","tags":["workout"]}`+"\n" {
+		t.Fatalf("tag file = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(t, s, http.MethodPost, "/api/tags/bulk", `{"files":["song.mp3","run.mp3","Show/ep1.mp3"],"add":["to-review"," team-share"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(t, s, http.MethodPost, "/api/tags/bulk", `{"files":["run.mp3"],"add":["workout"],"remove":["team-share"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodDelete, "/api/tags/to-review/files/Show/ep1.mp3", ""); rec.Code != http.StatusOK {
+		t.Fatalf("untag status = %d: %s", rec.Code, rec.Body)
+	}
+
+	cases := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/tags/bulk", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/api/tags/a,b/files/song.mp3", http.StatusBadRequest},
+		{http.MethodPut, "/api/tags/x/files/nope.mp3", http.StatusNotFound},
+		{http.MethodPut, "/api/tags/x/files/.ytdl2/library.json", http.StatusBadRequest},
+		{http.MethodGet, "/api/files?tag_any=,", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if rec := do(t, s, c.method, c.target, ""); rec.Code != c.want {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, rec.Code, c.want)
+		}
+	}
+	// Nothing is changed if any file is missing.
+	if rec := do(t, s, http.MethodPost, "/api/tags/bulk", `{"files":["song.mp3","nope.mp3"],"add":["x"]}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("bulk with missing file = %d", rec.Code)
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/tags", "")
+	var counts struct {
+		Tags []library.TagCount `json:"tags"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &counts)
+	want := []library.TagCount{{Name: "team-share", Count: 2}, {Name: "to-review", Count: 2}, {Name: "workout", Count: 2}}
+	if !slices.Equal(counts.Tags, want) {
+		t.Fatalf("tags = %+v, want %+v", counts.Tags, want)
+	}
+
+	// song: team-share, to-review, workout; run: to-review, workout;
+	// Show/ep1: team-share.
+	for query, want := range map[string][]string{
+		"tag_any=workout,team-share":            {"Show/ep1.mp3", "run.mp3", "song.mp3"},
+		"tag_all=workout,team-share":            {"song.mp3"},
+		"tag_none=workout":                      {"Show/ep1.mp3"},
+		"tag_any=to-review&tag_none=team-share": {"run.mp3"},
+		"dir=&tag_all=WORKOUT":                  {"run.mp3", "song.mp3"},
+	} {
+		rec := do(t, s, http.MethodGet, "/api/files?"+query, "")
+		var list listResp
+		json.Unmarshal(rec.Body.Bytes(), &list)
+		var got []string
+		for _, f := range list.Files {
+			got = append(got, f.Name)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("?%s = %v, want %v", query, got, want)
+		}
+	}
+
+	rec = do(t, s, http.MethodDelete, "/api/tags/workout", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"files":2,"tag":"workout"}`+"\n" {
+		t.Fatalf("delete tag = %d: %s", rec.Code, rec.Body)
+	}
+	if tr, _ := s.library.Get("run.mp3"); !slices.Equal(tr.Tags, []string{"to-review"}) {
+		t.Fatalf("run.mp3 tags = %v", tr.Tags)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/iwanhae/ytdl2/internal/command"
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+// maxTagBody bounds PATCH /tags bodies, which may carry a base64 cover image.
+const maxTagBody = 20 << 20
+
+// PATCH /api/files/{filename}/tags
+// Body: {"title"?: string, "artist"?: string, "album"?: string, "track"?: string,
+// "genre"?: string, "comment"?: string, "cover"?: base64 JPEG/PNG}
+// Rewrites the file's embedded tags with ffmpeg (stream copy, no re-encode) as
+// a tracked command. Omitted fields are kept, empty strings clear the tag. The
+// result is written to a temp file next to the original and renamed over it
+// only if ffmpeg succeeds (keeping its permissions), then the store entry is
+// refreshed from the new file. While an edit of the file is still running, a
+// second one fails with 409 rather than undoing it, as do moving or deleting
+// the file.
+func (s *Server) handleEditTags(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	name, status, err := s.libraryFile(filename)
+	if err != nil {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	filePath := filepath.Join(s.DownloadDirectory, name)
+
+	var body struct {
+		library.MetadataPatch
+		Cover string `json:"cover"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTagBody)).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid body: %v", err),
+		})
+		return
+	}
+	if body.MetadataPatch.Empty() && body.Cover == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Nothing to change",
+		})
+		return
+	}
+
+	var coverPath string
+	if body.Cover != "" {
+		if !library.CoverSupported(filePath) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Cover art can only be written to MP3, M4A and FLAC files",
+			})
+			return
+		}
+		coverPath, err = writeCover(body.Cover)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Invalid cover: %v", err),
+			})
+			return
+		}
+	}
+
+	// Held until the retagged copy is in place, so a second edit can't
+	// silently undo the first and the file can't be moved or deleted from
+	// under the rename.
+	unlock, ok := s.fileLocks.TryLock(name)
+	if !ok {
+		if coverPath != "" {
+			os.Remove(coverPath)
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "The file's tags are already being edited; try again when that finishes",
+		})
+		return
+	}
+
+	// Dotfile temp output in the same directory: hidden from listings and
+	// scans, and on the same filesystem so the final rename is atomic. It
+	// keeps the extension so ffmpeg picks the right muxer.
+	ext := filepath.Ext(filePath)
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+"-tags-*"+ext)
+	if err != nil {
+		unlock()
+		if coverPath != "" {
+			os.Remove(coverPath)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to create temp file: %v", err),
+		})
+		return
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+
+	patch := body.MetadataPatch
+	cmd := command.New("ffmpeg", library.WriteTagsArgs(filePath, tmpPath, patch, coverPath)...)
+	cmdID, err := s.runTracked(cmd, fmt.Sprintf("Edit tags: %s", name), func(exitCode int) {
+		defer unlock()
+		if coverPath != "" {
+			os.Remove(coverPath)
+		}
+		if exitCode != 0 {
+			os.Remove(tmpPath)
+			return
+		}
+		// Don't resurrect a file that went away some other way (a scan, the
+		// shell) while ffmpeg ran.
+		info, err := os.Stat(filePath)
+		if err != nil {
+			log.Printf("Dropping retagged copy of %s: %v", name, err)
+			os.Remove(tmpPath)
+			return
+		}
+		// CreateTemp makes the copy owner-only; keep the original's mode so
+		// other readers (a web server, a share) can still open the file.
+		if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+			log.Printf("Failed to copy permissions to retagged %s: %v", name, err)
+		}
+		if err := os.Rename(tmpPath, filePath); err != nil {
+			log.Printf("Failed to replace %s with retagged copy: %v", name, err)
+			os.Remove(tmpPath)
+			return
+		}
+		s.refreshTags(name, filePath, patch)
+	})
+	if err != nil {
+		unlock()
+		os.Remove(tmpPath)
+		if coverPath != "" {
+			os.Remove(coverPath)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Error executing ffmpeg: %v", err)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to edit tags: %v", err),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+		"id":     cmdID,
+	})
+}
+
+// refreshTags updates the store after a successful retag. Re-probing picks up
+// exactly what ffmpeg wrote; if that fails the patch is applied as sent. The
+// content changed, so the fingerprint is recomputed too.
+func (s *Server) refreshTags(filename, filePath string, patch library.MetadataPatch) {
+	p, probeErr := library.ProbeFile(filePath)
+	sum, sumErr := library.Fingerprint(filePath)
+	info, statErr := os.Stat(filePath)
+	if err := s.library.Update(filename, func(t *library.Track) {
+		if sumErr == nil && statErr == nil {
+			t.Size = info.Size()
+			t.Fingerprint = sum
+			t.SHA256 = ""
+		}
+		if probeErr != nil {
+			patch.Apply(&t.Meta)
+			return
+		}
+		t.Duration = p.Duration
+		t.Meta = p.Meta
+		t.Format = p.Format
+	}); err != nil {
+		log.Printf("Failed to persist tags for %s: %v", filename, err)
+	}
+	// The file changed, so its artwork is stale (and may have been replaced).
+	s.ensureArt(filename, filePath)
+}
+
+// writeCover decodes a base64 JPEG or PNG into a temp file and returns its path.
+func writeCover(b64 string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", err
+	}
+	var ext string
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	default:
+		return "", errors.New("must be a JPEG or PNG image")
+	}
+	f, err := os.CreateTemp("", "ytdl2-cover-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/iwanhae/ytdl2/internal/library"
+)
+
+func TestEditTagsValidation(t *testing.T) {
+	s, dir := newTestServer(t)
+	os.WriteFile(filepath.Join(dir, "show.ogg"), []byte("fake audio"), 0o644)
+
+	cases := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"wrong method", http.MethodPost, "/api/files/song.mp3/tags", `{"title":"x"}`, 405},
+		{"missing file", http.MethodPatch, "/api/files/nope.mp3/tags", `{"title":"x"}`, 404},
+		{"empty patch", http.MethodPatch, "/api/files/song.mp3/tags", `{}`, 400},
+		{"bad cover", http.MethodPatch, "/api/files/song.mp3/tags", `{"cover":"aGVsbG8="}`, 400},
+		{"cover unsupported", http.MethodPatch, "/api/files/show.ogg/tags", `{"cover":"aGVsbG8="}`, 400},
+	}
+	for _, c := range cases {
+		if rec := do(t, s, c.method, c.target, c.body); rec.Code != c.want {
+			t.Errorf("%s: status = %d, want %d (body=%s)", c.name, rec.Code, c.want, rec.Body.String())
+		}
+	}
+
+	// An edit still running makes a second one fail instead of waiting.
+	unlock, _ := s.fileLocks.TryLock("song.mp3")
+	defer unlock()
+	if rec := do(t, s, http.MethodPatch, "/api/files/song.mp3/tags", `{"title":"x"}`); rec.Code != http.StatusConflict {
+		t.Errorf("busy file: status = %d, want 409 (body=%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWriteTagsArgs(t *testing.T) {
+	title, genre := "New Title", ""
+	args := library.WriteTagsArgs("in.mp3", "out.mp3", library.MetadataPatch{Title: &title, Genre: &genre}, "")
+	for _, want := range [][]string{
+		{"-map", "0"},
+		{"-c", "copy"},
+		{"-metadata", "title=New Title"},
+		{"-metadata", "genre="}, // empty clears
+	} {
+		if !containsSeq(args, want) {
+			t.Fatalf("args %q missing %q", args, want)
+		}
+	}
+	if args[len(args)-1] != "out.mp3" {
+		t.Fatalf("output must come last: %q", args)
+	}
+	if slices.Contains(args, "artist=") {
+		t.Fatalf("untouched field written: %q", args)
+	}
+}
+
+func containsSeq(args, seq []string) bool {
+	for i := 0; i+len(seq) <= len(args); i++ {
+		if slices.Equal(args[i:i+len(seq)], seq) {
+			return true
+		}
+	}
+	return false
+}
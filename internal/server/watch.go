@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/iwanhae/ytdl2/internal/watch"
+)
+
+// WatchLibrary keeps the library in step with files added, replaced, moved or
+// deleted in the download directory behind the API's back (SMB copies, shell
+// moves), instead of waiting for the next restart's ScanLibrary.
+func (s *Server) WatchLibrary(opts watch.Options) (*watch.Watcher, error) {
+	w, err := watch.New(s.DownloadDirectory, opts, s.libraryChanged)
+	if err != nil {
+		return nil, err
+	}
+	if w.Polling() {
+		log.Printf("Watching %s by polling", s.DownloadDirectory)
+	} else {
+		log.Printf("Watching %s with inotify", s.DownloadDirectory)
+	}
+	return w, nil
+}
+
+// libraryChanged handles one settled batch from the watcher: a reconcile pass
+// drops deleted files and re-attaches moved ones, and new or replaced files are
+// (re)probed. Connected clients are then told to refresh.
+func (s *Server) libraryChanged(c watch.Changes) {
+	if len(c.Removed) > 0 {
+		if _, err := s.reconcileLibrary(); err != nil {
+			log.Printf("Failed to reconcile library: %v", err)
+		}
+	}
+	if len(c.Changed) > 0 {
+		<-s.scanner.ScanPaths(c.Changed)
+	}
+
+	s.broadcastLibraryUpdate(c)
+}
+
+// broadcastLibraryUpdate sends a "library" event on the commands stream so
+// open clients re-fetch the file list.
+func (s *Server) broadcastLibraryUpdate(c watch.Changes) {
+	if c.Changed == nil {
+		c.Changed = []string{}
+	}
+	if c.Removed == nil {
+		c.Removed = []string{}
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		log.Printf("Failed to marshal library update: %v", err)
+		return
+	}
+
+	message := fmt.Sprintf("event: library\ndata: %s\n\n", string(data))
+
+	s.commandsSubMu.RLock()
+	for ch := range s.commandsSubscribers {
+		select {
+		case ch <- message:
+		default:
+			// Client is slow, skip
+		}
+	}
+	s.commandsSubMu.RUnlock()
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const defaultWaveformPoints = 1024
+
+// GET /api/files/{filename}/waveform?points=N&format=json|binary
+// Response (json): {"name": string, "duration": float, "points": int, "peaks": [min, max, ...]}
+// Response (binary): points*2 signed bytes (min, max interleaved), with the
+// point count and duration in X-Waveform-Points / X-Waveform-Duration.
+// Peaks are scaled to -128..127. The first request for a file decodes it
+// (which can take a few seconds); later ones are served from the cache until
+// the file's modification time changes.
+func (s *Server) handleWaveform(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Method not allowed",
+		})
+		return
+	}
+
+	filePath, err := s.safePath(filename)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid filename",
+		})
+		return
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "File not found",
+		})
+		return
+	}
+
+	points := defaultWaveformPoints
+	if v := r.URL.Query().Get("points"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "points must be a positive integer",
+			})
+			return
+		}
+		points = n
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "binary" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "format must be \"json\" or \"binary\"",
+		})
+		return
+	}
+
+	wf, err := s.waveforms.Get(filename, filePath)
+	if err != nil {
+		log.Printf("Failed to build waveform for %s: %v", filename, err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to build waveform: %v", err),
+		})
+		return
+	}
+	peaks := wf.Peaks(points)
+
+	// The cache is keyed on mod time, so clients may reuse a copy only after
+	// checking it is still current.
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Last-Modified", wf.ModTime.UTC().Format(http.TimeFormat))
+
+	if format == "binary" {
+		buf := make([]byte, len(peaks))
+		for i, p := range peaks {
+			buf[i] = byte(p)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Waveform-Points", strconv.Itoa(len(peaks)/2))
+		w.Header().Set("X-Waveform-Duration", strconv.FormatFloat(wf.Duration, 'f', 3, 64))
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":     filename,
+		"duration": wf.Duration,
+		"points":   len(peaks) / 2,
+		"peaks":    peaks,
+	})
+}
@@ -0,0 +1,324 @@
+// Package watch reports files added, changed or removed under a directory tree
+// by something other than the server — a copy over SMB, a shell `mv`, another
+// downloader. Notifications come from inotify where available, with a polling
+// fallback; either way they only trigger a cheap stat walk whose result is
+// diffed against the last one, so missed or coalesced events can't leave the
+// view out of date. New and modified files are reported only once they have
+// stopped growing, and download temp files are ignored entirely.
+package watch
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Changes is one batch of settled differences. Names are relative to the
+// watched directory, slash-separated as on disk.
+type Changes struct {
+	Changed []string `json:"changed"` // new, or content changed since last reported
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether c has nothing in it.
+func (c Changes) Empty() bool {
+	return len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// Options tunes a Watcher. Zero values take the defaults.
+type Options struct {
+	// Debounce is how long to wait after the last event before walking the
+	// tree, so a burst of writes costs one walk. Default 2s.
+	Debounce time.Duration
+	// Settle is how long a file's size and mod time must stay unchanged
+	// before it is reported, so half-copied files aren't probed. Default 5s.
+	Settle time.Duration
+	// PollInterval is how often the tree is walked when inotify isn't used.
+	// Default 30s.
+	PollInterval time.Duration
+	// Poll skips inotify and only polls, e.g. for network mounts where
+	// changes made by other machines never raise inotify events.
+	Poll bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.Debounce <= 0 {
+		o.Debounce = 2 * time.Second
+	}
+	if o.Settle <= 0 {
+		o.Settle = 5 * time.Second
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 30 * time.Second
+	}
+	return o
+}
+
+// tempFile matches names downloaders and copy tools use while a file is still
+// being written; the final name shows up when they're done.
+var tempFile = regexp.MustCompile(`(?i)(\.part(-frag\d+)?|\.ytdl|\.tmp|\.temp|\.crdownload|\.partial|~)$|\.temp\.[^.]+$`)
+
+// Ignored reports whether a file or folder name is never reported: dotfiles
+// (including the .ytdl2 sidecar dir and the server's own temp files) and
+// in-progress downloads.
+func Ignored(name string) bool {
+	return strings.HasPrefix(name, ".") || tempFile.MatchString(name)
+}
+
+type state struct {
+	size    int64
+	modTime int64 // UnixNano
+}
+
+type pending struct {
+	state
+	since time.Time // when this state was first seen
+}
+
+// Watcher watches one directory tree. Create it with New and stop it with
+// Close.
+type Watcher struct {
+	dir  string
+	opts Options
+	fn   func(Changes)
+
+	fsw     *fsnotify.Watcher // nil when polling
+	known   map[string]state  // as last reported (or as found at start)
+	pending map[string]pending
+	kick    chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New starts watching dir and calls fn, from a single goroutine, with every
+// batch of changes. Files already present are taken as known and not
+// reported. If inotify can't be set up (or opts.Poll is set) the tree is
+// polled instead.
+func New(dir string, opts Options, fn func(Changes)) (*Watcher, error) {
+	known, err := snapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		dir:     dir,
+		opts:    opts.withDefaults(),
+		fn:      fn,
+		known:   known,
+		pending: make(map[string]pending),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if !w.opts.Poll {
+		fsw, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = w.addTree(fsw, dir)
+			if err != nil {
+				fsw.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("watch: inotify unavailable for %s (%v), polling every %s", dir, err, w.opts.PollInterval)
+		} else {
+			w.fsw = fsw
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Polling reports whether the watcher fell back to (or was configured for)
+// polling.
+func (w *Watcher) Polling() bool {
+	return w.fsw == nil
+}
+
+// Rescan asks for a walk right away, e.g. after the caller knows something
+// changed. It does not wait for it.
+func (w *Watcher) Rescan() {
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the watcher and waits for a running callback to return.
+func (w *Watcher) Close() error {
+	close(w.done)
+	w.wg.Wait()
+	if w.fsw != nil {
+		return w.fsw.Close()
+	}
+	return nil
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	var tick <-chan time.Time
+	if w.fsw != nil {
+		events, errs = w.fsw.Events, w.fsw.Errors
+	} else {
+		ticker := time.NewTicker(w.opts.PollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	schedule := func(d time.Duration) {
+		timer.Stop()
+		timer.Reset(d)
+	}
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() && !Ignored(info.Name()) {
+					if err := w.addTree(w.fsw, ev.Name); err != nil {
+						log.Printf("watch: %s: %v", ev.Name, err)
+					}
+				}
+			}
+			schedule(w.opts.Debounce)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			// Usually a queue overflow: events were lost, so walk.
+			log.Printf("watch: %v", err)
+			schedule(w.opts.Debounce)
+		case <-w.kick:
+			schedule(0)
+		case <-tick:
+			schedule(0)
+		case <-timer.C:
+			if next := w.scan(); next > 0 {
+				schedule(next)
+			}
+		}
+	}
+}
+
+// scan walks the tree, reports settled differences and returns how soon it
+// should run again to settle files still in flux (0 if none are).
+func (w *Watcher) scan() time.Duration {
+	cur, err := snapshot(w.dir)
+	if err != nil {
+		log.Printf("watch: %s: %v", w.dir, err)
+		return 0
+	}
+
+	now := time.Now()
+	var c Changes
+	var wait time.Duration
+	for name, st := range cur {
+		if k, ok := w.known[name]; ok && k == st {
+			delete(w.pending, name)
+			continue
+		}
+		p, ok := w.pending[name]
+		if !ok || p.state != st {
+			w.pending[name] = pending{state: st, since: now}
+			if wait == 0 {
+				wait = w.opts.Settle
+			}
+			continue
+		}
+		if left := w.opts.Settle - now.Sub(p.since); left > 0 {
+			if wait == 0 || left < wait {
+				wait = left
+			}
+			continue
+		}
+		c.Changed = append(c.Changed, name)
+		w.known[name] = st
+		delete(w.pending, name)
+	}
+	for name := range w.known {
+		if _, ok := cur[name]; !ok {
+			c.Removed = append(c.Removed, name)
+			delete(w.known, name)
+		}
+	}
+	for name := range w.pending {
+		if _, ok := cur[name]; !ok {
+			delete(w.pending, name)
+		}
+	}
+
+	if !c.Empty() {
+		w.fn(c)
+	}
+	return wait
+}
+
+// addTree adds an inotify watch for root and every non-hidden folder in it.
+func (w *Watcher) addTree(fsw *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // vanished or unreadable; the next walk will notice
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && Ignored(d.Name()) {
+			return filepath.SkipDir
+		}
+		return fsw.Add(path)
+	})
+}
+
+// snapshot records the size and mod time of every reportable file under dir.
+func snapshot(dir string) (map[string]state, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files := make(map[string]state)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return nil // tolerate unreadable entries
+		}
+		if path != dir && Ignored(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		files[rel] = state{size: info.Size(), modTime: info.ModTime().UnixNano()}
+		return nil
+	})
+	return files, err
+}
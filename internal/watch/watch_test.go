@@ -0,0 +1,73 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIgnored(t *testing.T) {
+	for name, want := range map[string]bool{
+		"song.mp3":                  false,
+		"Show/episode.m4a":          false,
+		".ytdl2":                    true,
+		".song.mp3-tags-123.mp3":    true,
+		"song.webm.part":            true,
+		"song.f251.webm.part-Frag3": true,
+		"song.webm.ytdl":            true,
+		"song.temp.mp3":             true,
+		"copy.mp3.crdownload":       true,
+		"notes.txt~":                true,
+	} {
+		if got := Ignored(filepath.Base(name)); got != want {
+			t.Errorf("Ignored(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestWatcherReportsSettledChanges(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		t.Run(map[bool]string{false: "inotify", true: "poll"}[poll], func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "old.mp3"), []byte("old"), 0o644)
+
+			got := make(chan Changes, 10)
+			w, err := New(dir, Options{
+				Debounce:     10 * time.Millisecond,
+				Settle:       50 * time.Millisecond,
+				PollInterval: 20 * time.Millisecond,
+				Poll:         poll,
+			}, func(c Changes) { got <- c })
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			os.Mkdir(filepath.Join(dir, "Show"), 0o755)
+			os.WriteFile(filepath.Join(dir, "Show", "new.mp3"), []byte("new"), 0o644)
+			os.WriteFile(filepath.Join(dir, "new.webm.part"), []byte("partial"), 0o644)
+			os.Remove(filepath.Join(dir, "old.mp3"))
+			w.Rescan()
+
+			var changed, removed []string
+			deadline := time.After(5 * time.Second)
+			for len(changed) == 0 || len(removed) == 0 {
+				select {
+				case c := <-got:
+					changed = append(changed, c.Changed...)
+					removed = append(removed, c.Removed...)
+				case <-deadline:
+					t.Fatalf("timed out; changed=%v removed=%v", changed, removed)
+				}
+			}
+			if !slices.Equal(changed, []string{filepath.Join("Show", "new.mp3")}) {
+				t.Errorf("changed = %v", changed)
+			}
+			if !slices.Equal(removed, []string{"old.mp3"}) {
+				t.Errorf("removed = %v", removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Package waveform computes min/max peak overviews of audio files for the
+// player's scrub bar. Audio is decoded by ffmpeg to low-rate mono PCM, reduced
+// to a fixed set of resolutions, and cached as JSON under the sidecar dir so a
+// file is only decoded again when its modification time changes.
+package waveform
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/iwanhae/ytdl2/internal/fsutil"
+)
+
+// Resolutions are the peak counts computed and cached for every file. Requests
+// for other counts are served by downsampling the next larger one.
+var Resolutions = []int{256, 1024, 4096}
+
+// generateTimeout stops an ffmpeg that hangs (a stalled network share, a
+// file it loops on). Decoding to 8 kHz mono runs hundreds of times faster
+// than real time, so even a very long file finishes well within it.
+const generateTimeout = 10 * time.Minute
+
+const (
+	sampleRate    = 8000 // Hz; plenty for an overview and cheap to decode
+	bucketSamples = sampleRate / 100
+)
+
+// Waveform is the cached peak data for one file. Each level holds interleaved
+// min/max pairs scaled to -128..127.
+type Waveform struct {
+	ModTime  time.Time      `json:"mod_time"`
+	Duration float64        `json:"duration"` // seconds of decoded audio
+	Levels   map[int][]int8 `json:"levels"`
+}
+
+// Peaks returns n min/max pairs for w, downsampling the smallest cached level
+// that has at least n points (or the largest level if n exceeds them all).
+func (w *Waveform) Peaks(n int) []int8 {
+	best := 0
+	for res := range w.Levels {
+		switch {
+		case best == 0:
+			best = res
+		case res >= n && (best < n || res < best):
+			best = res // smallest level that still covers n
+		case best < n && res > best:
+			best = res // nothing covers n yet; prefer the finest
+		}
+	}
+	if best == 0 {
+		return nil
+	}
+	if n > best {
+		n = best
+	}
+	return Downsample(w.Levels[best], n)
+}
+
+// ReadPeaks consumes signed 16-bit little-endian mono PCM from r and returns
+// one min/max pair per bucketSamples samples, plus the number of samples read.
+func ReadPeaks(r io.Reader) ([]int8, int, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var (
+		peaks    []int8
+		total    int
+		n        int
+		min, max int16
+		buf      [2]byte
+	)
+	for {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, total, err
+		}
+		v := int16(binary.LittleEndian.Uint16(buf[:]))
+		if n == 0 || v < min {
+			min = v
+		}
+		if n == 0 || v > max {
+			max = v
+		}
+		n++
+		total++
+		if n == bucketSamples {
+			peaks = append(peaks, int8(min>>8), int8(max>>8))
+			n = 0
+		}
+	}
+	if n > 0 {
+		peaks = append(peaks, int8(min>>8), int8(max>>8))
+	}
+	return peaks, total, nil
+}
+
+// Downsample reduces interleaved min/max pairs to n pairs, each covering an
+// equal share of the input. Fewer input pairs than n are stretched.
+func Downsample(peaks []int8, n int) []int8 {
+	pairs := len(peaks) / 2
+	if pairs == 0 || n <= 0 {
+		return []int8{}
+	}
+	out := make([]int8, 0, 2*n)
+	for i := 0; i < n; i++ {
+		lo := i * pairs / n
+		hi := (i + 1) * pairs / n
+		if hi <= lo {
+			hi = lo + 1
+		}
+		min, max := peaks[2*lo], peaks[2*lo+1]
+		for j := lo + 1; j < hi; j++ {
+			if peaks[2*j] < min {
+				min = peaks[2*j]
+			}
+			if peaks[2*j+1] > max {
+				max = peaks[2*j+1]
+			}
+		}
+		out = append(out, min, max)
+	}
+	return out
+}
+
+// Generate decodes path with ffmpeg and builds every resolution.
+func Generate(path string) (*Waveform, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-v", "error",
+		"-i", path,
+		"-vn", "-ac", "1", "-ar", fmt.Sprint(sampleRate),
+		"-f", "s16le", "-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffmpeg %q: %w", path, err)
+	}
+	peaks, samples, readErr := ReadPeaks(stdout)
+	if readErr != nil {
+		// Let ffmpeg finish writing so Wait doesn't hang on a full pipe.
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ffmpeg %q: %w", path, ctx.Err())
+		}
+		return nil, fmt.Errorf("ffmpeg %q: %w", path, err)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if samples == 0 {
+		return nil, fmt.Errorf("ffmpeg %q: no audio", path)
+	}
+
+	w := &Waveform{
+		ModTime:  info.ModTime(),
+		Duration: float64(samples) / sampleRate,
+		Levels:   make(map[int][]int8, len(Resolutions)),
+	}
+	for _, res := range Resolutions {
+		w.Levels[res] = Downsample(peaks, res)
+	}
+	return w, nil
+}
+
+// Cache stores generated waveforms as JSON files in dir, keyed by the file's
+// library-relative name.
+type Cache struct {
+	dir   string
+	locks fsutil.FileLocks // per-name, so one file is only decoded once at a time
+}
+
+// NewCache returns a cache rooted at dir (created lazily on first write).
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+func (c *Cache) file(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns the waveform for name (whose absolute path is path), decoding
+// and caching it if there is no cached copy or the file changed since.
+func (c *Cache) Get(name, path string) (*Waveform, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := c.locks.Lock(name)
+	defer unlock()
+
+	if data, err := os.ReadFile(c.file(name)); err == nil {
+		var w Waveform
+		if json.Unmarshal(data, &w) == nil && w.ModTime.Equal(info.ModTime()) {
+			return &w, nil
+		}
+	}
+
+	w, err := Generate(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.save(name, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (c *Cache) save(name string, w *Waveform) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(c.file(name), data)
+}
+
+// Delete drops the cached waveform for name. A missing entry is not an error.
+func (c *Cache) Delete(name string) error {
+	if err := os.Remove(c.file(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Rename re-keys the cached waveform for oldName to newName. A missing entry
+// is not an error.
+func (c *Cache) Rename(oldName, newName string) error {
+	if err := os.Rename(c.file(oldName), c.file(newName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package waveform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pcm(samples ...int16) *bytes.Reader {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestReadPeaks(t *testing.T) {
+	samples := make([]int16, bucketSamples+3)
+	samples[5] = 32767
+	samples[10] = -32768
+	samples[bucketSamples+1] = 256 // lands in the trailing partial bucket
+	peaks, n, err := ReadPeaks(pcm(samples...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(samples) {
+		t.Fatalf("samples = %d, want %d", n, len(samples))
+	}
+	want := []int8{-128, 127, 0, 1}
+	if !bytes.Equal(int8s(peaks), int8s(want)) {
+		t.Fatalf("peaks = %v, want %v", peaks, want)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	in := []int8{-1, 1, -5, 2, -2, 9, 0, 3}
+	if got := Downsample(in, 2); !bytes.Equal(int8s(got), int8s([]int8{-5, 2, -2, 9})) {
+		t.Fatalf("Downsample(2) = %v", got)
+	}
+	if got := Downsample(in, 8); len(got) != 16 || got[0] != -1 || got[15] != 3 {
+		t.Fatalf("Downsample(8) = %v", got)
+	}
+}
+
+func TestCacheServesUntilModTimeChanges(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mp3")
+	if err := os.WriteFile(src, []byte("not really audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(src)
+
+	c := NewCache(filepath.Join(dir, ".ytdl2", "waveforms"))
+	cached := &Waveform{ModTime: info.ModTime(), Duration: 1, Levels: map[int][]int8{4: {-1, 1, -2, 2, -3, 3, -4, 4}}}
+	if err := c.save("a.mp3", cached); err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.Get("a.mp3", src)
+	if err != nil {
+		t.Fatalf("cached Get: %v", err)
+	}
+	if got := w.Peaks(2); !bytes.Equal(int8s(got), int8s([]int8{-2, 2, -4, 4})) {
+		t.Fatalf("Peaks(2) = %v", got)
+	}
+
+	// Touch the file: the cache is stale and the (fake) file must be decoded,
+	// which fails without real audio/ffmpeg.
+	later := info.ModTime().Add(1e9)
+	os.Chtimes(src, later, later)
+	if _, err := c.Get("a.mp3", src); err == nil {
+		t.Fatal("stale cache entry was served")
+	}
+}
+
+func int8s(v []int8) []byte {
+	b := make([]byte, len(v))
+	for i, x := range v {
+		b[i] = byte(x)
+	}
+	return b
+}
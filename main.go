@@ -4,15 +4,28 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/iwanhae/ytdl2/internal/library"
 	"github.com/iwanhae/ytdl2/internal/server"
+	"github.com/iwanhae/ytdl2/internal/watch"
 )
 
 var (
-	downloadDirectory   = getEnv("DOWNLOAD_DIRECTORY", "./data")
-	staticDirectory     = getEnv("STATIC_DIRECTORY", "./static")
-	categoryThreshold   = getEnvInt("CATEGORY_THRESHOLD_SECONDS", 360) // >= this many seconds is guessed "podcast"
+	downloadDirectory  = getEnv("DOWNLOAD_DIRECTORY", "./data")
+	staticDirectory    = getEnv("STATIC_DIRECTORY", "./static")
+	categoryThreshold  = getEnvInt("CATEGORY_THRESHOLD_SECONDS", 360) // >= this many seconds is guessed "podcast"
+	chapterSilenceDB   = getEnvInt("CHAPTER_SILENCE_DB", -35)         // quieter than this counts as silence
+	chapterSilenceSecs = getEnvInt("CHAPTER_SILENCE_SECONDS", 2)      // pause length that marks a chapter boundary
+	chapterMinSeconds  = getEnvInt("CHAPTER_MIN_SECONDS", 60)         // shortest chapter kept by detection
+	libraryBackend     = getEnv("LIBRARY_BACKEND", "json")            // "json" or "bolt"
+	libraryWatch       = getEnv("LIBRARY_WATCH", "auto")              // "auto" (inotify, else polling), "poll" or "off"
+	libraryPollSeconds = getEnvInt("LIBRARY_POLL_SECONDS", 30)        // polling interval when not using inotify
+	feedCheckMinutes   = getEnvInt("FEED_CHECK_MINUTES", 60)          // how often podcast subscriptions are checked; 0 disables
 )
 
 func main() {
@@ -21,10 +34,45 @@ func main() {
 		log.Fatalf("Failed to create download directory: %v", err)
 	}
 
-	s := server.NewServer(downloadDirectory, staticDirectory, float64(categoryThreshold))
+	lib, err := library.Open(libraryBackend, filepath.Join(downloadDirectory, ".ytdl2"))
+	if err != nil {
+		log.Fatalf("Failed to open library: %v", err)
+	}
+	s := server.NewServerWithLibrary(downloadDirectory, staticDirectory, float64(categoryThreshold), lib)
+	s.ChapterSilence = library.SilenceOptions{
+		NoiseDB:    float64(chapterSilenceDB),
+		MinSilence: float64(chapterSilenceSecs),
+		MinChapter: float64(chapterMinSeconds),
+	}
 	// Migrate a pre-existing library: probe durations and guess categories in
 	// the background so startup isn't blocked.
 	s.ScanLibrary()
+	// Pick up files added or removed outside the API while we run.
+	if libraryWatch != "off" {
+		_, err := s.WatchLibrary(watch.Options{
+			Poll:         libraryWatch == "poll",
+			PollInterval: time.Duration(libraryPollSeconds) * time.Second,
+		})
+		if err != nil {
+			log.Printf("Failed to watch download directory: %v", err)
+		}
+	}
+
+	if feedCheckMinutes > 0 {
+		s.RunSubscriptions(time.Duration(feedCheckMinutes) * time.Minute)
+	}
+
+	// Save lazily written state (playback positions) when stopped.
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		if err := s.Close(); err != nil {
+			log.Printf("Failed to save playback state: %v", err)
+		}
+		lib.Close()
+		os.Exit(0)
+	}()
 
 	log.Println("Starting server with SPA support...")
 	log.Println("Server is running on :8080")
@@ -51,4 +99,3 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return n
 }
-
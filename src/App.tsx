@@ -16,7 +16,10 @@ function App() {
     <PlayerProvider>
       <Layout>
         <DownloadForm />
-        <CommandList onCommandComplete={handleCommandComplete} />
+        <CommandList
+          onCommandComplete={handleCommandComplete}
+          onLibraryChange={handleCommandComplete}
+        />
         <VideoList refreshKey={refreshKey} />
       </Layout>
     </PlayerProvider>
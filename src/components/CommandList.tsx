@@ -5,6 +5,7 @@ import { useNow } from '../lib/useNow';
 
 interface CommandListProps {
     onCommandComplete?: () => void;
+    onLibraryChange?: () => void;
 }
 
 function fmtElapsed(secs: number): string {
@@ -13,7 +14,7 @@ function fmtElapsed(secs: number): string {
     return `${String(m).padStart(2, '0')}:${String(s).padStart(2, '0')}`;
 }
 
-export default function CommandList({ onCommandComplete }: CommandListProps) {
+export default function CommandList({ onCommandComplete, onLibraryChange }: CommandListProps) {
     const [commands, setCommands] = useState<Command[]>([]);
     const [expandedLogs, setExpandedLogs] = useState<Set<string>>(new Set());
     const prevCommandsRef = useRef<Map<string, string>>(new Map());
@@ -45,6 +46,11 @@ export default function CommandList({ onCommandComplete }: CommandListProps) {
             }
         };
 
+        // Files added or removed outside the app (e.g. over SMB).
+        eventSource.addEventListener('library', () => {
+            onLibraryChange?.();
+        });
+
         eventSource.onerror = (error) => {
             console.error('Command stream error:', error);
             eventSource.close();
@@ -53,7 +59,7 @@ export default function CommandList({ onCommandComplete }: CommandListProps) {
         return () => {
             eventSource.close();
         };
-    }, [onCommandComplete]);
+    }, [onCommandComplete, onLibraryChange]);
 
     const toggleLogs = (id: string) => {
         setExpandedLogs((prev) => {
@@ -1,5 +1,5 @@
 import React, { createContext, useContext, useState, useEffect, useRef, useCallback, useMemo } from 'react';
-import { type FileInfo, type Scope, getFileUrl } from '../lib/api';
+import { type FileInfo, type Scope, getFileUrl, recordPlay, saveProgress } from '../lib/api';
 
 interface PlayerContextType {
     currentFile: FileInfo | null;
@@ -46,6 +46,10 @@ export function PlayerProvider({ children }: { children: React.ReactNode }) {
     const [analyser, setAnalyser] = useState<AnalyserNode | null>(null);
     const audioRef = useRef<HTMLAudioElement>(null);
     const audioCtxRef = useRef<AudioContext | null>(null);
+    // The file last loaded and whether it played to the end, to tell a skip
+    // from a finished play when the next file starts.
+    const loadedRef = useRef<FileInfo | null>(null);
+    const endedRef = useRef(false);
 
     // The play queue is the playlist filtered to the active scope. next/prev
     // and auto-advance walk this, so listening never crosses categories.
@@ -140,8 +144,25 @@ export function PlayerProvider({ children }: { children: React.ReactNode }) {
     // Handle file change
     useEffect(() => {
         if (currentFile && audioRef.current) {
-            audioRef.current.src = getFileUrl(currentFile.name);
-            audioRef.current.play().catch(e => console.error("Play failed:", e));
+            const audio = audioRef.current;
+            const previous = loadedRef.current;
+            if (previous && previous.name !== currentFile.name && !endedRef.current) {
+                recordPlay(previous.name, 'skip', audio.currentTime).catch(e => console.error("Record skip failed:", e));
+            }
+            loadedRef.current = currentFile;
+            endedRef.current = false;
+            audio.src = getFileUrl(currentFile.name);
+            // Resume where this file was left off, on any device.
+            const saved = currentFile.progress;
+            if (saved && !saved.completed && saved.position > 0) {
+                audio.addEventListener('loadedmetadata', () => {
+                    audio.currentTime = saved.position;
+                }, { once: true });
+            }
+            const name = currentFile.name;
+            audio.play()
+                .then(() => recordPlay(name, 'start'))
+                .catch(e => console.error("Play failed:", e));
 
             // Update MediaSession
             if ('mediaSession' in navigator) {
@@ -156,6 +177,22 @@ export function PlayerProvider({ children }: { children: React.ReactNode }) {
         }
     }, [currentFile]);
 
+    // Report the position while playing (and once more on pause, end or track
+    // change) so another device can pick up from here.
+    useEffect(() => {
+        const audio = audioRef.current;
+        if (!audio || !currentFile || !isPlaying) return;
+        const name = currentFile.name;
+        const report = () => {
+            saveProgress(name, audio.currentTime).catch(e => console.error("Save progress failed:", e));
+        };
+        const timer = window.setInterval(report, 10000);
+        return () => {
+            window.clearInterval(timer);
+            report();
+        };
+    }, [currentFile, isPlaying]);
+
     // Handle MediaSession actions
     useEffect(() => {
         if ('mediaSession' in navigator) {
@@ -181,6 +218,10 @@ export function PlayerProvider({ children }: { children: React.ReactNode }) {
         const onDurationChange = () => setDuration(audio.duration);
         const onEnded = () => {
             setIsPlaying(false);
+            endedRef.current = true;
+            if (loadedRef.current) {
+                recordPlay(loadedRef.current.name, 'complete').catch(e => console.error("Record play failed:", e));
+            }
             next(); // Auto-play next
         };
 
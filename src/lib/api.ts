@@ -1,6 +1,7 @@
 export const API_BASE = '/api';
 
-export type Category = 'music' | 'podcast';
+// Built-in categories plus any defined through /api/categories.
+export type Category = 'music' | 'podcast' | (string & {});
 export type Scope = 'all' | Category;
 
 export interface Command {
@@ -17,6 +18,41 @@ export interface FileInfo {
     mod_time: string;
     category?: Category;
     duration?: number; // seconds
+    art_url?: string;
+    meta?: TrackMeta;
+    format?: AudioFormat;
+    speech?: { score: number; windows: number }; // 0 = music … 1 = speech
+    tags?: string[];
+    added?: string; // when the library first saw the file
+    episode?: Episode; // for podcast subscription downloads
+    progress?: Progress;
+    play_status?: 'unplayed' | 'in_progress' | 'played';
+}
+
+// Where listening left off, shared across devices.
+export interface Progress {
+    position: number; // seconds
+    last_played?: string;
+    completed?: boolean;
+    plays?: number; // times played to the end
+    skips?: number;
+}
+
+export interface TrackMeta {
+    title?: string;
+    artist?: string;
+    album?: string;
+    track?: string;
+    date?: string;
+    comment?: string;
+    url?: string; // source page
+}
+
+export interface AudioFormat {
+    codec?: string;
+    bitrate?: number; // bits per second
+    sample_rate?: number;
+    channels?: number;
 }
 
 export interface AudioExtractionResponse {
@@ -88,6 +124,190 @@ export async function setCategory(filename: string, category: Category): Promise
     return response.json();
 }
 
+export interface CategoryDef {
+    name: Category;
+    label: string;
+    color?: string;
+    rule?: { min_seconds?: number; max_seconds?: number };
+    builtin: boolean;
+    tracks: number;
+}
+
+export async function getCategories(): Promise<CategoryDef[]> {
+    const response = await fetch(`${API_BASE}/categories`);
+    if (!response.ok) throw new Error('Failed to fetch categories');
+    const data = await response.json();
+    return data.categories || [];
+}
+
+export async function saveProgress(filename: string, position: number): Promise<Progress> {
+    const response = await fetch(`${API_BASE}/files/${encodeURIComponent(filename)}/progress`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ position }),
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to save progress');
+    }
+    return response.json();
+}
+
+export async function recordPlay(filename: string, event: 'start' | 'complete' | 'skip', position?: number): Promise<Progress> {
+    const response = await fetch(`${API_BASE}/files/${encodeURIComponent(filename)}/plays`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ event, position }),
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to record play');
+    }
+    return response.json();
+}
+
+export interface PlaylistSummary {
+    id: string;
+    name: string;
+    count: number;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface PlaylistEntry {
+    name: string;
+    missing?: boolean; // the file was deleted
+    file?: FileInfo;
+}
+
+export interface Playlist {
+    id: string;
+    name: string;
+    created_at: string;
+    updated_at: string;
+    entries: PlaylistEntry[];
+}
+
+export async function getPlaylists(): Promise<PlaylistSummary[]> {
+    const response = await fetch(`${API_BASE}/playlists`);
+    if (!response.ok) throw new Error('Failed to fetch playlists');
+    const data = await response.json();
+    return data.playlists || [];
+}
+
+export async function getPlaylist(id: string): Promise<Playlist> {
+    const response = await fetch(`${API_BASE}/playlists/${encodeURIComponent(id)}`);
+    if (!response.ok) throw new Error('Failed to fetch playlist');
+    return response.json();
+}
+
+export async function createPlaylist(name: string, files: string[] = []): Promise<Playlist> {
+    const response = await fetch(`${API_BASE}/playlists`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name, files }),
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to create playlist');
+    }
+    return response.json();
+}
+
+/** A playlist file URL; `files` exports the file listing with the given query instead. */
+export function getPlaylistExportUrl(id: string | { files: URLSearchParams }, format: 'm3u8' | 'xspf' = 'm3u8'): string {
+    if (typeof id === 'string') return `${API_BASE}/playlists/${encodeURIComponent(id)}.${format}`;
+    const query = id.files.toString();
+    return `${API_BASE}/files.${format}${query ? `?${query}` : ''}`;
+}
+
+export interface ImportedPlaylist extends Playlist {
+    unmatched: string[];
+}
+
+export async function importPlaylist(file: Blob, name?: string): Promise<ImportedPlaylist> {
+    const query = name ? `?name=${encodeURIComponent(name)}` : '';
+    const response = await fetch(`${API_BASE}/playlists/import${query}`, {
+        method: 'POST',
+        body: file,
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to import playlist');
+    }
+    return response.json();
+}
+
+// The feed's details of a downloaded podcast episode.
+export interface Episode {
+    show: string;
+    title: string;
+    published?: string;
+    notes?: string; // often HTML
+    link?: string;
+    guid?: string;
+}
+
+export interface Subscription {
+    id: string;
+    url: string;
+    title: string;
+    folder: string;
+    keep_latest: number; // 0 keeps every episode
+    downloaded: number;
+    created_at: string;
+    last_checked?: string;
+    last_error?: string;
+}
+
+export async function getSubscriptions(): Promise<Subscription[]> {
+    const response = await fetch(`${API_BASE}/subscriptions`);
+    if (!response.ok) throw new Error('Failed to fetch subscriptions');
+    const data = await response.json();
+    return data.subscriptions || [];
+}
+
+export async function subscribe(url: string, options: { title?: string; folder?: string; keep_latest?: number } = {}): Promise<Subscription> {
+    const response = await fetch(`${API_BASE}/subscriptions`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ url, ...options }),
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to subscribe');
+    }
+    return response.json();
+}
+
+export async function unsubscribe(id: string): Promise<void> {
+    const response = await fetch(`${API_BASE}/subscriptions/${encodeURIComponent(id)}`, { method: 'DELETE' });
+    if (!response.ok) throw new Error('Failed to unsubscribe');
+}
+
+export interface OPMLImport {
+    created: Subscription[];
+    skipped: string[];
+    failed: { url: string; title?: string; error: string }[];
+}
+
+export function getSubscriptionsExportUrl(): string {
+    return `${API_BASE}/subscriptions.opml`;
+}
+
+export async function importSubscriptions(file: Blob, keepLatest?: number): Promise<OPMLImport> {
+    const query = keepLatest !== undefined ? `?keep_latest=${keepLatest}` : '';
+    const response = await fetch(`${API_BASE}/subscriptions/import${query}`, {
+        method: 'POST',
+        body: file,
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to import subscriptions');
+    }
+    return response.json();
+}
+
 export function getFileUrl(filename: string): string {
     return `${API_BASE}/files/${encodeURIComponent(filename)}`;
 }